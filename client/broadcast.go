@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/WeilunZ/zRPC/components/selector"
+)
+
+const defaultConcurrency = 16
+
+// Result is the outcome of a broadcast call on one node
+type Result struct {
+	Node *selector.Node
+	Rsp  interface{} // response of the node, built by the newRsp func of Broadcast
+	Err  error
+}
+
+// Policy tells from the number of nodes of a broadcast and of the calls which succeeded and
+// failed so far whether the broadcast is complete, and if so whether it failed
+type Policy func(total, succeeded, failed int) (done bool, err error)
+
+// WaitAll waits for the calls on all nodes, the broadcast fails if any of them failed
+func WaitAll() Policy {
+	return func(total, succeeded, failed int) (bool, error) {
+		if succeeded+failed < total {
+			return false, nil
+		}
+		if failed > 0 {
+			return true, fmt.Errorf("broadcast failed on %d of %d nodes", failed, total)
+		}
+		return true, nil
+	}
+}
+
+// FirstN completes the broadcast once n calls succeeded, the remaining calls are canceled.
+// The broadcast fails as soon as too many calls failed for n of them to succeed.
+func FirstN(n int) Policy {
+	return func(total, succeeded, failed int) (bool, error) {
+		if succeeded >= n {
+			return true, nil
+		}
+		if total-failed < n {
+			return true, fmt.Errorf("broadcast failed on %d of %d nodes, %d successes required", failed, total, n)
+		}
+		return false, nil
+	}
+}
+
+// Quorum completes the broadcast once a majority of the calls succeeded
+func Quorum() Policy {
+	return func(total, succeeded, failed int) (bool, error) {
+		return FirstN(total/2+1)(total, succeeded, failed)
+	}
+}
+
+// Broadcast calls the method of servicePath on every node of the service the routes, zone and subset
+// of the client leave, at most concurrency at a time, until the policy completes. It returns the results of the completed calls, newRsp
+// builds the response of each node. The selector of the client must implement selector.Lister.
+func (c *defaultClient) Broadcast(ctx context.Context, servicePath string, req interface{},
+	newRsp func() interface{}, opts ...Option) ([]*Result, error) {
+	callOpts, err := c.callOptions(ctx, servicePath, opts...)
+	if err != nil {
+		return nil, err
+	}
+	serviceName := callOpts.serviceName
+
+	clientSelector, _, err := callOpts.selector()
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := clientSelector.(selector.Lister)
+	if !ok {
+		return nil, fmt.Errorf("selector of service %s cannot list its nodes", serviceName)
+	}
+	nodes, err := lister.List(ctx, serviceName, selector.WithNamespace(callOpts.resolveNamespace()),
+		selector.WithFilter(callOpts.filters()...))
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("%w for service %s", selector.ErrNoNodes, serviceName)
+	}
+
+	concurrency := callOpts.concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	policy := callOpts.policy
+	if policy == nil {
+		policy = WaitAll()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// every node sends exactly one result, calls left behind once the policy completed never block
+	results := make(chan *Result, len(nodes))
+	go func() {
+		sem := make(chan struct{}, concurrency)
+		for _, node := range nodes {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results <- &Result{Node: node, Err: ctx.Err()}
+				continue
+			}
+			go func(node *selector.Node) {
+				defer func() { <-sem }()
+				rsp := newRsp()
+				err := c.invoke(selector.WithNode(ctx, node), callOpts, req, rsp)
+				results <- &Result{Node: node, Rsp: rsp, Err: err}
+			}(node)
+		}
+	}()
+
+	var (
+		completed         []*Result
+		succeeded, failed int
+	)
+	for range nodes {
+		r := <-results
+		completed = append(completed, r)
+		if r.Err != nil {
+			failed++
+		} else {
+			succeeded++
+		}
+		if done, err := policy(len(nodes), succeeded, failed); done {
+			return completed, err
+		}
+	}
+	return completed, nil
+}
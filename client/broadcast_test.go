@@ -0,0 +1,28 @@
+package client
+
+import "testing"
+
+func TestPolicies(t *testing.T) {
+	tests := []struct {
+		name              string
+		policy            Policy
+		succeeded, failed int
+		done, failing     bool
+	}{
+		{"wait all pending", WaitAll(), 3, 1, false, false},
+		{"wait all succeeded", WaitAll(), 5, 0, true, false},
+		{"wait all failed", WaitAll(), 4, 1, true, true},
+		{"first n pending", FirstN(2), 1, 2, false, false},
+		{"first n succeeded", FirstN(2), 2, 0, true, false},
+		{"first n unreachable", FirstN(2), 1, 4, true, true},
+		{"quorum pending", Quorum(), 2, 2, false, false},
+		{"quorum succeeded", Quorum(), 3, 0, true, false},
+		{"quorum unreachable", Quorum(), 0, 3, true, true},
+	}
+	for _, tt := range tests {
+		done, err := tt.policy(5, tt.succeeded, tt.failed)
+		if done != tt.done || (err != nil) != tt.failing {
+			t.Errorf("%s : policy(5, %d, %d) = %v, %v", tt.name, tt.succeeded, tt.failed, done, err)
+		}
+	}
+}
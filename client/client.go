@@ -2,11 +2,17 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
 	metrics2 "github.com/WeilunZ/zRPC/plugin/metrics"
 
 	"github.com/WeilunZ/zRPC/components/interceptor"
+	"github.com/WeilunZ/zRPC/components/metadata"
 	"github.com/WeilunZ/zRPC/components/utils"
 
 	"github.com/WeilunZ/zRPC/components/connpool"
@@ -22,21 +28,37 @@ import (
 
 type Client interface {
 	Invoke(ctx context.Context, req, resp interface{}, path string, opts ...Option) error
+	Call(ctx context.Context, servicePath string, req interface{}, rsp interface{}, opts ...Option) error
+	Broadcast(ctx context.Context, servicePath string, req interface{}, newRsp func() interface{}, opts ...Option) ([]*Result, error)
 }
 
+// defaultClient is immutable once built, the options of a call are applied to a copy of its options
 type defaultClient struct {
-	opts *Options
+	opts      *Options
+	transport transport.ClientTransport // built for the protocol of the client
 }
 
 //单例的全局唯一client
 var DefaultClient = New()
 
 var New = func() *defaultClient {
-	return &defaultClient{
+	c := &defaultClient{
 		opts: &Options{
 			protocol: "proto",
 		},
 	}
+	c.transport = c.NewClientTransport()
+	return c
+}
+
+// NewClient returns a client configured with opts, it is safe for concurrent use
+func NewClient(opts ...Option) Client {
+	c := New()
+	for _, o := range opts {
+		o(c.opts)
+	}
+	c.transport = c.NewClientTransport()
+	return c
 }
 
 var (
@@ -45,50 +67,71 @@ var (
 
 func (c *defaultClient) Call(ctx context.Context, servicePath string,
 	req interface{}, rsp interface{}, opts ...Option) error {
-	// reflection calls need to be serialized using msgpack
-	callOpts := make([]Option, 0, len(opts)+1)
-	callOpts = append(callOpts, opts...)
-	callOpts = append(callOpts, WithSerializationType(codec.MsgPack))
-
 	//servicePath example: /helloworld.Greeter/SayHello
-	err := c.Invoke(ctx, req, rsp, servicePath, callOpts...)
+	callOpts, err := c.callOptions(ctx, servicePath, opts...)
 	if err != nil {
 		return err
 	}
-	return nil
+	// reflection calls are serialized using msgpack unless told otherwise
+	if callOpts.serializationType == "" {
+		callOpts.serializationType = codec.MsgPack
+	}
+	return c.invoke(ctx, callOpts, req, rsp)
 }
 
 func (c *defaultClient) Invoke(ctx context.Context, req, resp interface{}, path string, opts ...Option) error {
-	for _, o := range opts {
-		o(c.opts)
+	callOpts, err := c.callOptions(ctx, path, opts...)
+	if err != nil {
+		return err
 	}
+	return c.invoke(ctx, callOpts, req, resp)
+}
 
-	if c.opts.timeout > 0 {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, c.opts.timeout)
-		defer cancel()
+// callOptions returns the options of a call to path : the options of the client,
+// overridden by the ones of the context, then by opts
+func (c *defaultClient) callOptions(ctx context.Context, path string, opts ...Option) (*Options, error) {
+	callOpts := c.opts.clone()
+	for _, o := range optionsFromContext(ctx) {
+		o(callOpts)
+	}
+	for _, o := range opts {
+		o(callOpts)
 	}
 
 	serviceName, method, err := utils.ParseServicePath(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	c.opts.serviceName = serviceName
-	c.opts.method = method
+	callOpts.serviceName = serviceName
+	callOpts.method = method
+	return callOpts, nil
+}
 
-	return interceptor.ClientIntercept(ctx, req, resp, c.opts.interceptors, c.doInvoke)
+// invoke runs a call through the interceptors
+func (c *defaultClient) invoke(ctx context.Context, opts *Options, req, rsp interface{}) error {
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	return interceptor.ClientIntercept(ctx, req, rsp, opts.interceptors, func(ctx context.Context, req, rsp interface{}) error {
+		return c.doInvoke(ctx, opts, req, rsp)
+	})
 }
 
-func (c *defaultClient) doInvoke(ctx context.Context, req, rsp interface{}) error {
-	serialization := codec.GetSerialization(c.opts.serializationType)
+func (c *defaultClient) doInvoke(ctx context.Context, opts *Options, req, rsp interface{}) error {
+	serialization := codec.GetSerialization(opts.serializationType)
 	payload, err := serialization.Serialize(req)
 	if err != nil {
 		return errors.New("client request marshal failed")
 	}
-	clientCodec := codec.GetCodec(c.opts.protocol)
+	clientCodec := codec.GetCodec(opts.protocol)
 
 	// assemble header
-	request := addReqHeader(ctx, c, payload)
+	request, err := addReqHeader(ctx, opts, payload)
+	if err != nil {
+		return err
+	}
 	reqbuf, err := proto.Marshal(request)
 	if err != nil {
 		return err
@@ -99,14 +142,36 @@ func (c *defaultClient) doInvoke(ctx context.Context, req, rsp interface{}) erro
 		return err
 	}
 
-	clientTransport := c.NewClientTransport()
+	clientSelector, network, err := opts.selector()
+	if err != nil {
+		return err
+	}
+	// requests would be sent in plaintext
+	if opts.tlsConfig != nil && strings.HasPrefix(network, "udp") {
+		return transport.ErrTLSOverUDP
+	}
+	balancerName, err := opts.balancer()
+	if err != nil {
+		return err
+	}
+
+	clientTransport := c.transport
+	if opts.protocol != c.opts.protocol {
+		clientTransport = transport.GetClientTransport(opts.protocol, transport.WithClientPool(connpool.GetPool("default")))
+	}
 	clientTransportOpts := []transport.ClientTransportOption{
-		transport.WithServiceName(c.opts.serviceName),
-		transport.WithClientTarget(c.opts.target),
-		transport.WithClientNetwork(c.opts.network),
-		transport.WithClientPool(connpool.GetPool("default")),
-		transport.WithSelector(selector.GetSelector(c.opts.selectorName)),
-		transport.WithTimeout(c.opts.timeout),
+		transport.WithServiceName(opts.serviceName),
+		transport.WithClientTarget(opts.target),
+		transport.WithClientNetwork(network),
+		transport.WithClientPool(opts.pool()),
+		transport.WithSelector(clientSelector),
+		transport.WithSelectOptions(
+			selector.WithBalancerName(balancerName),
+			selector.WithFilter(opts.filters()...),
+			selector.WithNamespace(opts.resolveNamespace()),
+		),
+		transport.WithTimeout(opts.timeout),
+		transport.WithRetransmitInterval(opts.retransmit),
 	}
 	frame, err := clientTransport.Send(ctx, reqbody, clientTransportOpts...)
 	if err != nil {
@@ -136,20 +201,136 @@ func (c *defaultClient) doInvoke(ctx context.Context, req, rsp interface{}) erro
 	return serialization.Deserialize(response.Payload, rsp)
 }
 
+// selector returns the selector and network of the call : the selector named by the options,
+// the one of the target scheme, or a static selector over the endpoints or the target address
+func (o *Options) selector() (selector.Selector, string, error) {
+	if o.selectorName != "" {
+		return selector.GetSelector(o.selectorName), o.network, nil
+	}
+	if len(o.endpoints) > 0 {
+		return selector.GetStaticSelector(o.endpoints...), o.network, nil
+	}
+	if _, ok := selector.ParseTarget(o.target); !ok {
+		return selector.GetStaticSelector(o.target), o.network, nil
+	}
+
+	s, network, err := selector.GetTargetSelector(o.target)
+	if err != nil {
+		return nil, "", err
+	}
+	if network == "" {
+		network = o.network
+	}
+	return s, network, nil
+}
+
+// tlsPools keeps a connection pool per tls config, connections of a pool are dialed with its config
+var tlsPools = new(sync.Map) // *tls.Config -> connpool.Pool
+
+// pool returns the pool of the connections of the call
+func (o *Options) pool() connpool.Pool {
+	if o.tlsConfig == nil {
+		return connpool.GetPool("default")
+	}
+	if p, ok := tlsPools.Load(o.tlsConfig); ok {
+		return p.(connpool.Pool)
+	}
+	p, _ := tlsPools.LoadOrStore(o.tlsConfig, connpool.NewConnPool(connpool.WithDialer(tlsDialer(o.tlsConfig))))
+	return p.(connpool.Pool)
+}
+
+// tlsDialer dials tls connections and completes their handshake, the server name verified
+// defaults to the host dialed
+func tlsDialer(cfg *tls.Config) connpool.Dialer {
+	return func(ctx context.Context, network, address string, timeout time.Duration) (net.Conn, error) {
+		dialCfg := cfg
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			name := cfg.ServerName
+			if name == "" {
+				name = host
+			}
+			switch {
+			case cfg.VerifyConnection != nil:
+				// the server name of the connection state is empty for ip addresses, which are not sent
+				// in the handshake, custom verifications such as the tlsconfig ones get the name verified
+				dialCfg = cfg.Clone()
+				dialCfg.ServerName = name
+				dialCfg.VerifyConnection = func(cs tls.ConnectionState) error {
+					if cs.ServerName == "" {
+						cs.ServerName = name
+					}
+					return cfg.VerifyConnection(cs)
+				}
+			case cfg.ServerName == "" && !cfg.InsecureSkipVerify:
+				dialCfg = cfg.Clone()
+				dialCfg.ServerName = name
+			}
+		}
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, address, dialCfg)
+	}
+}
+
+// resolveNamespace returns the namespace the called service is resolved in
+func (o *Options) resolveNamespace() string {
+	if o.targetNamespace != "" {
+		return o.targetNamespace
+	}
+	return o.namespace
+}
+
+// balancer returns the name of the balancer of the call, the slow start balancer of its kind if slow start is on
+func (o *Options) balancer() (string, error) {
+	if o.slowStartWindow <= 0 {
+		return o.balancerName, nil
+	}
+	kind := o.balancerName
+	if kind == "" {
+		kind = selector.P2C
+	}
+	return selector.SlowStartBalancer(kind, o.slowStartWindow, o.slowStartMode)
+}
+
+// filters returns the filters narrowing down the nodes of the call, in the order they apply
+func (o *Options) filters() []selector.Filter {
+	var filters []selector.Filter
+	if o.router != nil {
+		filters = append(filters, o.router)
+	}
+	if o.zoneFilter != nil {
+		filters = append(filters, o.zoneFilter)
+	}
+	if o.subsetFilter != nil {
+		filters = append(filters, o.subsetFilter)
+	}
+	return filters
+}
+
 func (c *defaultClient) NewClientTransport() transport.ClientTransport {
-	return transport.GetClientTransport(c.opts.protocol)
+	return transport.GetClientTransport(c.opts.protocol, transport.WithClientPool(connpool.GetPool("default")))
 }
 
-func addReqHeader(ctx context.Context, client *defaultClient, payload []byte) *protocol.Request {
-	servicePath := fmt.Sprintf("/%s/%s", client.opts.serviceName, client.opts.method)
+func addReqHeader(ctx context.Context, opts *Options, payload []byte) (*protocol.Request, error) {
+	servicePath := fmt.Sprintf("/%s/%s", opts.serviceName, opts.method)
 
-	// TODO pass metadata
-	// TODO add authentication info
+	md := metadata.ClientMetadata(ctx)
+	if len(opts.credentials) > 0 {
+		md = md.Copy()
+		for _, creds := range opts.credentials {
+			authMD, err := creds.GetRequestMetadata(ctx, servicePath, payload)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range authMD {
+				md[k] = v
+			}
+		}
+	}
 
 	request := &protocol.Request{
 		ServicePath: servicePath,
+		Metadata:    md.ToHeader(),
 		Payload:     payload,
 	}
 
-	return request
+	return request, nil
 }
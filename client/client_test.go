@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/interceptor"
+	"github.com/WeilunZ/zRPC/components/selector"
+)
+
+func TestCallOptions(t *testing.T) {
+	noop := func(ctx context.Context, req, rsp interface{}, ivk interceptor.ClientInvoker) error {
+		return ivk(ctx, req, rsp)
+	}
+	c := NewClient(WithTarget("127.0.0.1:8000"), WithTimeout(time.Second), WithInterceptor(noop)).(*defaultClient)
+
+	ctx := ContextWithOptions(context.Background(), WithTimeout(2*time.Second), WithSerializationType("msgpack"))
+	opts, err := c.callOptions(ctx, "/helloworld.Greeter/SayHello", WithTimeout(3*time.Second), WithInterceptor(noop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.serviceName != "helloworld.Greeter" || opts.method != "SayHello" {
+		t.Fatalf("call to %s/%s", opts.serviceName, opts.method)
+	}
+	// the options of the call override the ones of the context
+	if opts.timeout != 3*time.Second || opts.serializationType != "msgpack" || len(opts.interceptors) != 2 {
+		t.Fatalf("call options = %+v", opts)
+	}
+
+	// the client is left untouched
+	if c.opts.timeout != time.Second || c.opts.serviceName != "" || c.opts.serializationType != "" || len(c.opts.interceptors) != 1 {
+		t.Fatalf("client options = %+v", c.opts)
+	}
+}
+
+func TestSlowStartOption(t *testing.T) {
+	opts := &Options{}
+	WithSlowStart(time.Minute, selector.Exponential)(opts)
+	name, err := opts.balancer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := selector.GetBalancer(name).(selector.Updater); !ok || name == selector.P2C {
+		t.Fatalf("balancer() = %s, want a registered slow start balancer", name)
+	}
+
+	WithBalancerName(selector.Random)(opts)
+	if _, err := opts.balancer(); err == nil {
+		t.Fatal("balancer() with slow start over random succeeded")
+	}
+}
@@ -1,9 +1,13 @@
 package client
 
 import (
+	"context"
+	"crypto/tls"
 	"time"
 
+	"github.com/WeilunZ/zRPC/components/credentials"
 	"github.com/WeilunZ/zRPC/components/interceptor"
+	"github.com/WeilunZ/zRPC/components/selector"
 	"github.com/WeilunZ/zRPC/transport"
 )
 
@@ -11,18 +15,59 @@ import (
 type Options struct {
 	serviceName       string        // service name
 	method            string        // method name
-	target            string        // format e.g.:  ip:port 127.0.0.1:8000
+	target            string        // format e.g.:  ip:port 127.0.0.1:8000, or scheme://authority/endpoint e.g. consul://127.0.0.1:8500/helloworld.Greeter
+	endpoints         []string      // static list of addresses balanced over, e.g. : 127.0.0.1:8000、127.0.0.1:8001
 	timeout           time.Duration // timeout
 	network           string        // network type, e.g.:  tcp、udp
 	protocol          string        // protocol type , e.g. : proto、json
 	serializationType string        // seralization type , e.g. : proto、msgpack
 	transportOpts     transport.ClientTransportOptions
 	interceptors      []interceptor.ClientInterceptor
-	selectorName      string // service discovery name, e.g. : consul、zookeeper、etcd
+	selectorName      string        // service discovery name, e.g. : consul、zookeeper、etcd
+	balancerName      string        // load balancing mode, e.g. : random、roundRobin、weightedRoundRobin、p2c
+	slowStartWindow   time.Duration // duration over which the weight of new nodes ramps up, disabled if 0
+	slowStartMode     selector.SlowStartMode
+	router            selector.Filter // routing rules applied before balancing
+	zoneFilter        selector.Filter // prefers the nodes of the client zone
+	subsetFilter      selector.Filter // restricts the client to its subset of the nodes
+	namespace         string          // namespace of the client, services are resolved in it
+	targetNamespace   string          // namespace of the called service when calling across namespaces
+	concurrency       int             // maximum number of concurrent calls of a broadcast
+	policy            Policy          // completion policy of a broadcast
+	retransmit        time.Duration   // interval before retransmitting a request sent over udp
+	tlsConfig         *tls.Config     // calls over tls once set
+	credentials       []credentials.PerCallCredentials
 }
 
 type Option func(*Options)
 
+// clone returns a copy of the options which options can be applied to without altering o
+func (o *Options) clone() *Options {
+	c := *o
+	// appending to the copied slices must not write to the backing arrays of o
+	c.endpoints = o.endpoints[:len(o.endpoints):len(o.endpoints)]
+	c.interceptors = o.interceptors[:len(o.interceptors):len(o.interceptors)]
+	c.credentials = o.credentials[:len(o.credentials):len(o.credentials)]
+	return &c
+}
+
+type optionsKey struct{}
+
+// ContextWithOptions returns a context applying opts to the calls made with it,
+// after the options of the client and before the options of the call
+func ContextWithOptions(ctx context.Context, opts ...Option) context.Context {
+	parent := optionsFromContext(ctx)
+	all := make([]Option, 0, len(parent)+len(opts))
+	all = append(all, parent...)
+	all = append(all, opts...)
+	return context.WithValue(ctx, optionsKey{}, all)
+}
+
+func optionsFromContext(ctx context.Context) []Option {
+	opts, _ := ctx.Value(optionsKey{}).([]Option)
+	return opts
+}
+
 func WithServiceName(serviceName string) Option {
 	return func(o *Options) {
 		o.serviceName = serviceName
@@ -41,6 +86,13 @@ func WithTarget(target string) Option {
 	}
 }
 
+// WithEndpoints balances the calls over a static list of addresses instead of a selector
+func WithEndpoints(endpoints ...string) Option {
+	return func(o *Options) {
+		o.endpoints = endpoints
+	}
+}
+
 func WithTimeout(timeout time.Duration) Option {
 	return func(o *Options) {
 		o.timeout = timeout
@@ -71,6 +123,94 @@ func WithSelectorName(selectorName string) Option {
 	}
 }
 
+func WithBalancerName(balancerName string) Option {
+	return func(o *Options) {
+		o.balancerName = balancerName
+	}
+}
+
+// WithSlowStart ramps up the weight of the nodes joining a service over window, the balancer must be
+// p2c or weightedRoundRobin, p2c if none is set
+func WithSlowStart(window time.Duration, mode selector.SlowStartMode) Option {
+	return func(o *Options) {
+		o.slowStartWindow = window
+		o.slowStartMode = mode
+	}
+}
+
+// WithRoutes routes the calls to the nodes matching the tags of the first route matching the call metadata
+func WithRoutes(routes ...selector.Route) Option {
+	return func(o *Options) {
+		o.router = selector.NewRouter(routes...)
+	}
+}
+
+// WithZone prefers the nodes of the given zone, spilling over to the failover zones in order,
+// then to all other zones, while fewer than minHealthy nodes are available in the zone
+func WithZone(zone string, minHealthy int, failover ...string) Option {
+	return func(o *Options) {
+		o.zoneFilter = selector.NewZoneFilter(zone, minHealthy, failover...)
+	}
+}
+
+// WithSubset restricts the client to a deterministic subset of size nodes, clientID must be stable
+// across restarts of the client, e.g. its hostname, for its subset to stay the same
+func WithSubset(clientID string, size int) Option {
+	return func(o *Options) {
+		o.subsetFilter = selector.NewSubsetFilter(clientID, size)
+	}
+}
+
+// WithNamespace sets the namespace of the client, only the services registered in it are called
+func WithNamespace(namespace string) Option {
+	return func(o *Options) {
+		o.namespace = namespace
+	}
+}
+
+// WithCrossNamespace opts in to calling a service registered in another namespace than the client's
+func WithCrossNamespace(namespace string) Option {
+	return func(o *Options) {
+		o.targetNamespace = namespace
+	}
+}
+
+// WithRetransmitInterval sets the interval before retransmitting a request sent over udp,
+// doubled at every retransmission
+func WithRetransmitInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.retransmit = interval
+	}
+}
+
+// WithTLSConfig calls over tls, see the tlsconfig package for configs reloading the client certificate
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *Options) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithCredentials attaches the authentication data of the credentials to the metadata of every call
+func WithCredentials(creds ...credentials.PerCallCredentials) Option {
+	return func(o *Options) {
+		o.credentials = append(o.credentials, creds...)
+	}
+}
+
+// WithConcurrency sets the maximum number of nodes a broadcast calls at a time
+func WithConcurrency(concurrency int) Option {
+	return func(o *Options) {
+		o.concurrency = concurrency
+	}
+}
+
+// WithPolicy sets when a broadcast is complete, e.g. WaitAll(), FirstN(2) or Quorum()
+func WithPolicy(policy Policy) Option {
+	return func(o *Options) {
+		o.policy = policy
+	}
+}
+
 func WithInterceptor(interceptors ...interceptor.ClientInterceptor) Option {
 	return func(o *Options) {
 		o.interceptors = append(o.interceptors, interceptors...)
@@ -0,0 +1,330 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/credentials"
+	"github.com/WeilunZ/zRPC/components/interceptor"
+	"github.com/WeilunZ/zRPC/components/log"
+	"github.com/WeilunZ/zRPC/components/peer"
+	"github.com/WeilunZ/zRPC/components/state"
+)
+
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+const defaultReloadInterval = 10 * time.Second
+
+// Policy decides which callers may call which methods, e.g. :
+//
+//	{
+//	    "roles": {"ops": ["alice", "spiffe://example.org/deployer"]},
+//	    "rules": [
+//	        {"effect": "allow", "roles": ["ops"], "methods": ["/*/*"]},
+//	        {"effect": "allow", "principals": ["*"], "methods": ["/helloworld.Greeter/*"]},
+//	        {"effect": "deny", "subjects": ["billing.internal"], "methods": ["/helloworld.Greeter/Delete"]}
+//	    ]
+//	}
+//
+// Deny rules take precedence over allow rules, calls matching no rule get the default effect,
+// deny if empty.
+type Policy struct {
+	Default string              `json:"default"`
+	Roles   map[string][]string `json:"roles"` // role -> principal names or certificate subjects granted the role
+	Rules   []Rule              `json:"rules"`
+}
+
+// Rule applies its effect to the calls of its callers to its methods
+type Rule struct {
+	Effect     string   `json:"effect"`     // allow or deny
+	Principals []string `json:"principals"` // names of authenticated principals, * for any of them
+	Roles      []string `json:"roles"`      // roles of the policy or granted by the authenticator
+	Subjects   []string `json:"subjects"`   // identities of verified peer certificates, * for any of them
+	Methods    []string `json:"methods"`    // service path patterns, e.g. /helloworld.Greeter/*
+}
+
+// Caller is who makes a call, as known from its credentials and its certificate
+type Caller struct {
+	Principal string
+	Roles     []string // roles granted by the authenticator
+	Subject   string
+}
+
+// AuditEntry records an authorization decision
+type AuditEntry struct {
+	Time        time.Time
+	Caller      Caller
+	ServicePath string
+	Decision    string
+	Rule        int // index of the rule deciding, -1 for the default effect
+}
+
+// LoadPolicy reads a json policy file
+func LoadPolicy(file string) (*Policy, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	policy := &Policy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("parse policy file %s error, %v", file, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("policy file %s, %v", file, err)
+	}
+	return policy, nil
+}
+
+func (p *Policy) validate() error {
+	if p.Default != "" && p.Default != Allow && p.Default != Deny {
+		return fmt.Errorf("invalid default effect %s", p.Default)
+	}
+	for i, rule := range p.Rules {
+		if rule.Effect != Allow && rule.Effect != Deny {
+			return fmt.Errorf("rule %d, invalid effect %s", i, rule.Effect)
+		}
+		for _, pattern := range rule.Methods {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d, invalid method pattern %s", i, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Decide returns the effect of the policy on a call and the index of the rule deciding, -1 for the default effect
+func (p *Policy) Decide(caller Caller, servicePath string) (string, int) {
+	allowed := -1
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if !rule.matchesMethod(servicePath) || !rule.matchesCaller(p, caller) {
+			continue
+		}
+		if rule.Effect == Deny {
+			return Deny, i
+		}
+		if allowed == -1 {
+			allowed = i
+		}
+	}
+	if allowed != -1 {
+		return Allow, allowed
+	}
+	if p.Default == Allow {
+		return Allow, -1
+	}
+	return Deny, -1
+}
+
+func (r *Rule) matchesMethod(servicePath string) bool {
+	for _, pattern := range r.Methods {
+		if pattern == "*" {
+			return true
+		}
+		if ok, _ := path.Match(pattern, servicePath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matchesCaller(p *Policy, caller Caller) bool {
+	if caller.Principal != "" && matchesName(r.Principals, caller.Principal) {
+		return true
+	}
+	if caller.Subject != "" && matchesName(r.Subjects, caller.Subject) {
+		return true
+	}
+	for _, role := range r.Roles {
+		if contains(caller.Roles, role) {
+			return true
+		}
+		members := p.Roles[role]
+		if (caller.Principal != "" && contains(members, caller.Principal)) ||
+			(caller.Subject != "" && contains(members, caller.Subject)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesName(names []string, name string) bool {
+	for _, n := range names {
+		if n == "*" || n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorizer enforces a policy, reloading it from its file once the file changes
+type Authorizer struct {
+	file           string
+	reloadInterval time.Duration
+	audit          func(AuditEntry)
+
+	mu      sync.Mutex
+	policy  *Policy
+	stamp   string    // modification time and size of the policy file loaded
+	checked time.Time // last time the file was checked for changes
+}
+
+type Option func(*Authorizer)
+
+// WithReloadInterval returns an Option which sets how often the policy file is checked for changes
+func WithReloadInterval(interval time.Duration) Option {
+	return func(a *Authorizer) {
+		a.reloadInterval = interval
+	}
+}
+
+// WithAudit returns an Option which sets where the decisions are recorded, they are logged by default
+func WithAudit(audit func(AuditEntry)) Option {
+	return func(a *Authorizer) {
+		a.audit = audit
+	}
+}
+
+// NewAuthorizer returns an Authorizer enforcing a fixed policy
+func NewAuthorizer(policy *Policy, opts ...Option) *Authorizer {
+	a := &Authorizer{policy: policy, audit: logAudit}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// NewFileAuthorizer returns an Authorizer enforcing the policy of a json file, reloaded once the file changes.
+// A policy file which cannot be loaded any more keeps the previous policy in force.
+func NewFileAuthorizer(file string, opts ...Option) (*Authorizer, error) {
+	a := &Authorizer{file: file, reloadInterval: defaultReloadInterval, audit: logAudit}
+	for _, o := range opts {
+		o(a)
+	}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload loads the policy file again
+func (a *Authorizer) Reload() error {
+	info, err := os.Stat(a.file)
+	if err != nil {
+		return err
+	}
+	policy, err := LoadPolicy(a.file)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.policy, a.stamp, a.checked = policy, fileStamp(info), time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+// Policy returns the policy in force
+func (a *Authorizer) Policy() *Policy {
+	if a.file == "" {
+		return a.policy
+	}
+
+	a.mu.Lock()
+	reload := false
+	if time.Since(a.checked) >= a.reloadInterval {
+		a.checked = time.Now()
+		if info, err := os.Stat(a.file); err == nil && fileStamp(info) != a.stamp {
+			reload = true
+		}
+	}
+	a.mu.Unlock()
+
+	if reload {
+		if err := a.Reload(); err != nil {
+			log.Errorf("authorization policy reload error, %v", err)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.policy
+}
+
+// Authorize decides whether the caller of ctx may call servicePath, and records the decision
+func (a *Authorizer) Authorize(ctx context.Context, servicePath string) error {
+	caller := CallerFromContext(ctx)
+	decision, rule := a.Policy().Decide(caller, servicePath)
+	a.audit(AuditEntry{
+		Time:        time.Now(),
+		Caller:      caller,
+		ServicePath: servicePath,
+		Decision:    decision,
+		Rule:        rule,
+	})
+	if decision != Allow {
+		return state.NewFrameworkError(state.PermissionDenied, fmt.Sprintf("permission denied to %s", servicePath))
+	}
+	return nil
+}
+
+// Interceptor returns a server interceptor rejecting the calls the policy denies with a PermissionDenied error.
+// Interceptors run once the request is decoded, pass the Authorizer to zRPC.WithAuthorizer to check the
+// policy before.
+func (a *Authorizer) Interceptor() interceptor.ServerInterceptor {
+	return func(ctx context.Context, req interface{}, handler interceptor.ServerHandler) (interface{}, error) {
+		info, ok := interceptor.ServerInfoFromContext(ctx)
+		if !ok {
+			return nil, state.NewFrameworkError(state.PermissionDenied, "permission denied, unknown method")
+		}
+		if err := a.Authorize(ctx, info.ServicePath); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func fileStamp(info os.FileInfo) string {
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// CallerFromContext returns the caller of the call served with ctx
+func CallerFromContext(ctx context.Context) Caller {
+	var caller Caller
+	if p, ok := credentials.PrincipalFromContext(ctx); ok {
+		caller.Principal = p.Name
+		caller.Roles = p.Roles
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		caller.Subject = p.Identity
+	}
+	return caller
+}
+
+// logAudit logs the denied calls as warnings and the allowed ones at debug level
+func logAudit(e AuditEntry) {
+	format := "authz audit : decision=%s method=%s principal=%q subject=%q rule=%d"
+	if e.Decision == Allow {
+		log.Debugf(format, e.Decision, e.ServicePath, e.Caller.Principal, e.Caller.Subject, e.Rule)
+		return
+	}
+	log.Warningf(format, e.Decision, e.ServicePath, e.Caller.Principal, e.Caller.Subject, e.Rule)
+}
@@ -0,0 +1,102 @@
+package authz
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/WeilunZ/zRPC/components/credentials"
+	"github.com/WeilunZ/zRPC/components/interceptor"
+	"github.com/WeilunZ/zRPC/components/peer"
+	"github.com/WeilunZ/zRPC/components/state"
+)
+
+const policyJSON = `{
+	"roles": {"ops": ["alice", "spiffe://example.org/deployer"]},
+	"rules": [
+		{"effect": "allow", "roles": ["ops"], "methods": ["/*/*"]},
+		{"effect": "allow", "principals": ["*"], "methods": ["/helloworld.Greeter/*"]},
+		{"effect": "deny", "subjects": ["billing.internal"], "methods": ["/helloworld.Greeter/Delete"]}
+	]
+}`
+
+func TestDecide(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(file, []byte(policyJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		caller      Caller
+		servicePath string
+		decision    string
+	}{
+		{Caller{Principal: "alice"}, "/admin.Service/Drain", Allow},
+		{Caller{Subject: "spiffe://example.org/deployer"}, "/admin.Service/Drain", Allow},
+		{Caller{Principal: "bob", Roles: []string{"ops"}}, "/admin.Service/Drain", Allow},
+		{Caller{Principal: "bob"}, "/admin.Service/Drain", Deny},
+		{Caller{Principal: "bob"}, "/helloworld.Greeter/SayHello", Allow},
+		{Caller{Principal: "bob", Subject: "billing.internal"}, "/helloworld.Greeter/Delete", Deny},
+		{Caller{Principal: "alice", Subject: "billing.internal"}, "/helloworld.Greeter/Delete", Deny},
+		{Caller{}, "/helloworld.Greeter/SayHello", Deny},
+	}
+	for _, tt := range tests {
+		if decision, _ := policy.Decide(tt.caller, tt.servicePath); decision != tt.decision {
+			t.Errorf("Decide(%+v, %s) = %s, want %s", tt.caller, tt.servicePath, decision, tt.decision)
+		}
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "policy.json")
+	if err := ioutil.WriteFile(file, []byte(policyJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var audited []AuditEntry
+	a, err := NewFileAuthorizer(file, WithReloadInterval(0), WithAudit(func(e AuditEntry) {
+		audited = append(audited, e)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	ctx := interceptor.WithServerInfo(context.Background(), &interceptor.ServerInfo{ServicePath: "/admin.Service/Drain"})
+	ctx = peer.NewContext(ctx, &peer.Peer{Identity: "billing.internal"})
+	ctx = credentials.NewContext(ctx, &credentials.Principal{Name: "bob"})
+
+	_, err = a.Interceptor()(ctx, nil, handler)
+	if e, ok := err.(*state.Error); !ok || e.Code != state.PermissionDenied {
+		t.Fatalf("denied call error = %v", err)
+	}
+	if len(audited) != 1 || audited[0].Decision != Deny || audited[0].Caller.Subject != "billing.internal" {
+		t.Fatalf("audit = %+v", audited)
+	}
+
+	// the policy is reloaded once the file changes
+	if err := ioutil.WriteFile(file, []byte(`{"default": "allow"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if rsp, err := a.Interceptor()(ctx, nil, handler); err != nil || rsp != "ok" {
+		t.Fatalf("allowed call = %v, %v", rsp, err)
+	}
+}
@@ -3,6 +3,7 @@ package codec
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 )
 
 // Codec defines the codec specification for data
@@ -15,6 +16,9 @@ const FrameHeaderLength = 15
 const MagicNumber = 0x11
 const Version = 0
 
+// JSONRPC is the protocol of the json-rpc 2.0 messages, framed as json values separated by new lines
+const JSONRPC = "jsonrpc"
+
 // FrameHeader : [魔数1b][版本号1b][消息类型1b][请求类型1b][是否压缩1b][流id2b][消息长度4b][保留位4b]
 type FrameHeader struct {
 	Magic        uint8  // magic
@@ -48,6 +52,7 @@ func GetCodec(name string) Codec {
 
 func init() {
 	RegisterCodec(Proto, DefaultCodec)
+	RegisterCodec(JSONRPC, &jsonrpcCodec{})
 }
 
 type defaultCodec struct{}
@@ -98,3 +103,20 @@ func (c *defaultCodec) Encode(data []byte) ([]byte, error) {
 func (c *defaultCodec) Decode(data []byte) ([]byte, error) {
 	return data[FrameHeaderLength:], nil
 }
+
+type jsonrpcCodec struct{}
+
+func (c *jsonrpcCodec) Encode(data []byte) ([]byte, error) {
+	msg := make([]byte, len(data)+1)
+	copy(msg, data)
+	msg[len(data)] = '\n'
+	return msg, nil
+}
+
+func (c *jsonrpcCodec) Decode(data []byte) ([]byte, error) {
+	msg := bytes.TrimSpace(data)
+	if len(msg) == 0 {
+		return nil, errors.New("empty json-rpc message")
+	}
+	return msg, nil
+}
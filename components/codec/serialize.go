@@ -2,6 +2,7 @@ package codec
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"github.com/vmihailenco/msgpack/v5"
 	"math"
@@ -40,6 +41,7 @@ var serializationMap = make(map[string]Serialization)
 func init() {
 	RegisterSerialization(MsgPack, &msgPackSerialization{})
 	RegisterSerialization(Proto, &protoSerialization{})
+	RegisterSerialization(Json, &jsonSerialization{})
 }
 
 func RegisterSerialization(name string, serialization Serialization) {
@@ -61,6 +63,7 @@ var DefaultSerialization = func() Serialization {
 
 type protoSerialization struct{}
 type msgPackSerialization struct{}
+type jsonSerialization struct{}
 
 func (p *protoSerialization) Serialize(v interface{}) ([]byte, error) {
 	if v == nil {
@@ -124,3 +127,11 @@ func (m *msgPackSerialization) Deserialize(data []byte, v interface{}) error {
 	err := decoder.Decode(v)
 	return err
 }
+
+func (j *jsonSerialization) Serialize(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (j *jsonSerialization) Deserialize(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
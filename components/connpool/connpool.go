@@ -106,6 +106,9 @@ func (p *pool) NewChannelPool(ctx context.Context, network string, address strin
 				timeout = t.Sub(time.Now())
 			}
 
+			if p.opts.dialer != nil {
+				return p.opts.dialer(ctx, network, address, timeout)
+			}
 			return net.DialTimeout(network, address, timeout)
 		},
 		conns:       make(chan *PoolConn, p.opts.maxCap),
@@ -113,12 +116,12 @@ func (p *pool) NewChannelPool(ctx context.Context, network string, address strin
 		dialTimeout: p.opts.dialTimeout,
 	}
 
-	if p.opts.initialCap == 0 {
+	if c.initialCap == 0 {
 		// default initialCap is 1
-		p.opts.initialCap = 1
+		c.initialCap = 1
 	}
 
-	for i := 0; i < p.opts.initialCap; i++ {
+	for i := 0; i < c.initialCap; i++ {
 		conn, err := c.Dial(ctx)
 		if err != nil {
 			return nil, err
@@ -1,6 +1,10 @@
 package connpool
 
-import "time"
+import (
+	"context"
+	"net"
+	"time"
+)
 
 type Options struct {
 	initialCap  int // initial capacity
@@ -8,8 +12,12 @@ type Options struct {
 	idleTimeout time.Duration
 	maxIdle     int           // max idle connections
 	dialTimeout time.Duration // dial timeout
+	dialer      Dialer        // dials the connections, net.DialTimeout if nil
 }
 
+// Dialer dials a connection of the pool within timeout
+type Dialer func(ctx context.Context, network, address string, timeout time.Duration) (net.Conn, error)
+
 type Option func(*Options)
 
 func WithInitialCap(initialCap int) Option {
@@ -41,3 +49,10 @@ func WithDialTimeout(dialTimeout time.Duration) Option {
 		o.dialTimeout = dialTimeout
 	}
 }
+
+// WithDialer returns an Option which sets how the connections of the pool are dialed, e.g. over tls
+func WithDialer(dialer Dialer) Option {
+	return func(o *Options) {
+		o.dialer = dialer
+	}
+}
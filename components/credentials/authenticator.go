@@ -0,0 +1,188 @@
+package credentials
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/metadata"
+)
+
+const defaultMaxSkew = 5 * time.Minute
+
+// ErrNoCredentials is returned by authenticators when the call carries none of their credentials
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal is the authenticated caller of a call
+type Principal struct {
+	Name   string   // e.g. the user of a token or the owner of a key
+	Scheme string   // how the caller authenticated, e.g. bearer, apikey, hmac
+	Roles  []string // roles granted by the authenticator, e.g. from the claims of a token
+}
+
+// CallInfo is what a call is authenticated from
+type CallInfo struct {
+	ServicePath string
+	Metadata    metadata.MD
+	Payload     []byte
+}
+
+// Authenticator validates the credentials of a call before its handler runs and returns its principal
+type Authenticator interface {
+	Authenticate(ctx context.Context, info *CallInfo) (*Principal, error)
+}
+
+// Authorizer decides whether the caller of ctx may call servicePath, e.g. the authz.Authorizer.
+// Servers call it once the call is authenticated, before its request is decoded.
+type Authorizer interface {
+	Authorize(ctx context.Context, servicePath string) error
+}
+
+// AuthenticatorFunc is an Authenticator function
+type AuthenticatorFunc func(ctx context.Context, info *CallInfo) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, info *CallInfo) (*Principal, error) {
+	return f(ctx, info)
+}
+
+type principalKey struct{}
+
+// NewContext returns a context carrying the principal of a call
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal of the call served with ctx
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Chain returns an Authenticator accepting the calls authenticated by the first of the
+// authenticators whose credentials they carry, e.g. to accept both tokens and api keys
+func Chain(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, info *CallInfo) (*Principal, error) {
+		for _, a := range authenticators {
+			p, err := a.Authenticate(ctx, info)
+			if err == ErrNoCredentials {
+				continue
+			}
+			return p, err
+		}
+		return nil, ErrNoCredentials
+	})
+}
+
+// BearerTokenAuthenticator returns an Authenticator validating bearer tokens, validate returns
+// the name of the owner of a valid token
+func BearerTokenAuthenticator(validate func(ctx context.Context, token string) (string, error)) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, info *CallInfo) (*Principal, error) {
+		authorization := info.Metadata.Get(AuthorizationKey)
+		if !strings.HasPrefix(authorization, bearerPrefix) {
+			return nil, ErrNoCredentials
+		}
+		name, err := validate(ctx, strings.TrimPrefix(authorization, bearerPrefix))
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{Name: name, Scheme: "bearer"}, nil
+	})
+}
+
+// APIKeyAuthenticator returns an Authenticator accepting the api keys of keys, which maps
+// every key to the name of its owner
+func APIKeyAuthenticator(keys map[string]string) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, info *CallInfo) (*Principal, error) {
+		key := info.Metadata.Get(APIKeyKey)
+		if key == "" {
+			return nil, ErrNoCredentials
+		}
+		for k, name := range keys {
+			if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+				return &Principal{Name: name, Scheme: "apikey"}, nil
+			}
+		}
+		return nil, errors.New("invalid api key")
+	})
+}
+
+// HMACAuthenticator returns an Authenticator verifying the signatures of the calls signed with the
+// secrets of secrets, keyed by key id. Calls signed more than maxSkew away from now are rejected,
+// as are nonces already seen, so that signed calls cannot be replayed.
+func HMACAuthenticator(secrets map[string][]byte, maxSkew time.Duration) Authenticator {
+	if maxSkew <= 0 {
+		maxSkew = defaultMaxSkew
+	}
+	return &hmacAuthenticator{
+		secrets: secrets,
+		maxSkew: maxSkew,
+		nonces:  make(map[string]time.Time),
+	}
+}
+
+type hmacAuthenticator struct {
+	secrets map[string][]byte
+	maxSkew time.Duration
+
+	mu     sync.Mutex
+	nonces map[string]time.Time // nonce -> expiry, nonces are remembered as long as their timestamp is valid
+	purged time.Time            // last time the expired nonces were dropped
+}
+
+func (h *hmacAuthenticator) Authenticate(ctx context.Context, info *CallInfo) (*Principal, error) {
+	md := info.Metadata
+	keyID, signature := md.Get(KeyIDKey), md.Get(SignatureKey)
+	if keyID == "" || signature == "" {
+		return nil, ErrNoCredentials
+	}
+	secret, ok := h.secrets[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s", keyID)
+	}
+
+	timestamp, nonce := md.Get(TimestampKey), md.Get(NonceKey)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid timestamp")
+	}
+	signedAt := time.Unix(unix, 0)
+	if skew := time.Since(signedAt); skew > h.maxSkew || skew < -h.maxSkew {
+		return nil, errors.New("signature expired")
+	}
+
+	expected := Sign(secret, info.ServicePath, timestamp, nonce, info.Payload)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, errors.New("invalid signature")
+	}
+
+	if nonce == "" || !h.remember(nonce, signedAt.Add(h.maxSkew)) {
+		return nil, errors.New("nonce already used")
+	}
+	return &Principal{Name: keyID, Scheme: "hmac"}, nil
+}
+
+// remember records a nonce until expiry, it returns false if the nonce was already seen
+func (h *hmacAuthenticator) remember(nonce string, expiry time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if now := time.Now(); now.Sub(h.purged) >= time.Second {
+		h.purged = now
+		for n, e := range h.nonces {
+			if e.Before(now) {
+				delete(h.nonces, n)
+			}
+		}
+	}
+	if _, ok := h.nonces[nonce]; ok {
+		return false
+	}
+	h.nonces[nonce] = expiry
+	return true
+}
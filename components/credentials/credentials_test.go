@@ -0,0 +1,69 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/metadata"
+)
+
+func callInfo(t *testing.T, creds PerCallCredentials, servicePath string, payload []byte) *CallInfo {
+	md, err := creds.GetRequestMetadata(context.Background(), servicePath, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CallInfo{ServicePath: servicePath, Metadata: metadata.New(md), Payload: payload}
+}
+
+func TestHMAC(t *testing.T) {
+	ctx := context.Background()
+	a := HMACAuthenticator(map[string][]byte{"billing": []byte("secret")}, time.Minute)
+
+	info := callInfo(t, NewHMAC("billing", []byte("secret")), "/helloworld.Greeter/SayHello", []byte("payload"))
+	p, err := a.Authenticate(ctx, info)
+	if err != nil || p.Name != "billing" || p.Scheme != "hmac" {
+		t.Fatalf("Authenticate() = %v, %v", p, err)
+	}
+	if _, err := a.Authenticate(ctx, info); err == nil {
+		t.Fatal("expected a replayed call to be rejected")
+	}
+
+	tampered := callInfo(t, NewHMAC("billing", []byte("secret")), "/helloworld.Greeter/SayHello", []byte("payload"))
+	tampered.Payload = []byte("other payload")
+	if _, err := a.Authenticate(ctx, tampered); err == nil {
+		t.Fatal("expected a tampered call to be rejected")
+	}
+
+	forged := callInfo(t, NewHMAC("billing", []byte("guess")), "/helloworld.Greeter/SayHello", nil)
+	if _, err := a.Authenticate(ctx, forged); err == nil {
+		t.Fatal("expected a call signed with another secret to be rejected")
+	}
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+	a := Chain(
+		BearerTokenAuthenticator(func(ctx context.Context, token string) (string, error) {
+			if token != "token" {
+				return "", errors.New("invalid token")
+			}
+			return "alice", nil
+		}),
+		APIKeyAuthenticator(map[string]string{"key": "bob"}),
+	)
+
+	if p, err := a.Authenticate(ctx, callInfo(t, NewBearerToken("token"), "/s/m", nil)); err != nil || p.Name != "alice" {
+		t.Fatalf("bearer Authenticate() = %v, %v", p, err)
+	}
+	if p, err := a.Authenticate(ctx, callInfo(t, NewAPIKey("key"), "/s/m", nil)); err != nil || p.Name != "bob" {
+		t.Fatalf("api key Authenticate() = %v, %v", p, err)
+	}
+	if _, err := a.Authenticate(ctx, callInfo(t, NewAPIKey("other"), "/s/m", nil)); err == nil {
+		t.Fatal("expected an unknown api key to be rejected")
+	}
+	if _, err := a.Authenticate(ctx, &CallInfo{ServicePath: "/s/m"}); err != ErrNoCredentials {
+		t.Fatalf("Authenticate() without credentials = %v", err)
+	}
+}
@@ -10,6 +10,24 @@ type ClientInterceptor func(ctx context.Context, req, resp interface{}, ivk Clie
 
 type ServerInterceptor func(ctx context.Context, req interface{}, handler ServerHandler) (interface{}, error)
 
+// ServerInfo describes the call server interceptors run for
+type ServerInfo struct {
+	ServicePath string // e.g. /helloworld.Greeter/SayHello
+}
+
+type serverInfoKey struct{}
+
+// WithServerInfo returns a context carrying the description of the call it serves
+func WithServerInfo(ctx context.Context, info *ServerInfo) context.Context {
+	return context.WithValue(ctx, serverInfoKey{}, info)
+}
+
+// ServerInfoFromContext returns the description of the call served with ctx
+func ServerInfoFromContext(ctx context.Context) (*ServerInfo, bool) {
+	info, ok := ctx.Value(serverInfoKey{}).(*ServerInfo)
+	return info, ok
+}
+
 func ClientIntercept(ctx context.Context, req, resp interface{}, interceptors []ClientInterceptor, ivk ClientInvoker) error {
 	if len(interceptors) == 0 {
 		return ivk(ctx, req, resp)
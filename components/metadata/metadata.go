@@ -0,0 +1,78 @@
+package metadata
+
+import "context"
+
+// MD is the metadata of a call, e.g. x-canary : true. It travels in the request header.
+type MD map[string]string
+
+type clientMDKey struct{}
+type serverMDKey struct{}
+
+// New returns the metadata of the given pairs
+func New(m map[string]string) MD {
+	md := make(MD, len(m))
+	for k, v := range m {
+		md[k] = v
+	}
+	return md
+}
+
+// Get returns the value of a key, "" if it is missing
+func (md MD) Get(key string) string {
+	return md[key]
+}
+
+// Copy returns a copy of the metadata
+func (md MD) Copy() MD {
+	return New(md)
+}
+
+// WithClientMetadata returns a context whose outgoing calls carry md
+func WithClientMetadata(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, clientMDKey{}, md)
+}
+
+// ClientMetadata returns the metadata of the outgoing calls of ctx
+func ClientMetadata(ctx context.Context) MD {
+	md, _ := ctx.Value(clientMDKey{}).(MD)
+	return md
+}
+
+// AppendToClientContext returns a context whose outgoing calls carry key : value on top of its metadata
+func AppendToClientContext(ctx context.Context, key, value string) context.Context {
+	md := ClientMetadata(ctx).Copy()
+	md[key] = value
+	return WithClientMetadata(ctx, md)
+}
+
+// WithServerMetadata returns a context carrying the metadata of an incoming call
+func WithServerMetadata(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, serverMDKey{}, md)
+}
+
+// ServerMetadata returns the metadata of the incoming call of ctx
+func ServerMetadata(ctx context.Context) MD {
+	md, _ := ctx.Value(serverMDKey{}).(MD)
+	return md
+}
+
+// ToHeader converts the metadata to the request header format
+func (md MD) ToHeader() map[string][]byte {
+	if len(md) == 0 {
+		return nil
+	}
+	header := make(map[string][]byte, len(md))
+	for k, v := range md {
+		header[k] = []byte(v)
+	}
+	return header
+}
+
+// FromHeader converts the request header metadata
+func FromHeader(header map[string][]byte) MD {
+	md := make(MD, len(header))
+	for k, v := range header {
+		md[k] = string(v)
+	}
+	return md
+}
@@ -0,0 +1,53 @@
+package peer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+// Peer is the remote end of the connection a request came in on
+type Peer struct {
+	Addr     net.Addr
+	TLS      *tls.ConnectionState // state of the tls connection, nil over plaintext
+	Identity string               // identity of the verified certificate of the peer, empty if it did not present one
+}
+
+type peerKey struct{}
+
+// NewContext returns a context carrying the peer of a request
+func NewContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// FromContext returns the peer of the request served with ctx
+func FromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+// New returns the peer of conn, tls connections must have completed their handshake
+func New(conn net.Conn) *Peer {
+	p := &Peer{Addr: conn.RemoteAddr()}
+	if tc, ok := conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		p.TLS = &state
+		if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+			p.Identity = Identity(state.VerifiedChains[0][0])
+		}
+	}
+	return p
+}
+
+// Identity returns the identity a certificate stands for : its first URI SAN, e.g. a spiffe id,
+// else its first DNS SAN, else its common name
+func Identity(cert *x509.Certificate) string {
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
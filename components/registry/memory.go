@@ -0,0 +1,118 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/WeilunZ/zRPC/components/selector"
+)
+
+const Memory = "memory"
+
+// DefaultMemoryRegistry is shared by all servers and clients of the process, e.g. for
+// integration tests or single binary deployments which do not run a registry
+var DefaultMemoryRegistry = NewMemoryRegistry()
+
+func init() {
+	RegisterRegistry(Memory, DefaultMemoryRegistry)
+	selector.RegisterSelector(Memory, NewSelector(DefaultMemoryRegistry))
+}
+
+// MemoryRegistry is an in-process Registry
+type MemoryRegistry struct {
+	mu       sync.Mutex
+	index    uint64 // last index handed out, shared by all services
+	services map[string]*memoryService
+}
+
+type memoryService struct {
+	index   uint64                    // index of the last change of the service
+	nodes   map[string]*selector.Node // address -> node
+	changed chan struct{}             // closed on the next change of the service
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		services: make(map[string]*memoryService),
+	}
+}
+
+func (m *MemoryRegistry) Register(ctx context.Context, serviceName string, node *selector.Node) error {
+	if node == nil || node.Address == "" {
+		return errors.New("register error, node address is empty")
+	}
+	n := *node
+	n.Key = serviceName + "/" + node.Address
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.service(serviceName)
+	s.nodes[node.Address] = &n
+	m.notify(s)
+	return nil
+}
+
+func (m *MemoryRegistry) Deregister(ctx context.Context, serviceName string, node *selector.Node) error {
+	if node == nil {
+		return errors.New("deregister error, node is nil")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.service(serviceName)
+	if _, ok := s.nodes[node.Address]; !ok {
+		return nil
+	}
+	delete(s.nodes, node.Address)
+	m.notify(s)
+	return nil
+}
+
+func (m *MemoryRegistry) Watch(ctx context.Context, serviceName string, lastIndex uint64) ([]*selector.Node, uint64, error) {
+	m.mu.Lock()
+	s := m.service(serviceName)
+	for s.index == lastIndex {
+		changed := s.changed
+		m.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, lastIndex, ctx.Err()
+		}
+		m.mu.Lock()
+	}
+	defer m.mu.Unlock()
+
+	nodes := make([]*selector.Node, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		n := *node
+		nodes = append(nodes, &n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Address < nodes[j].Address })
+	return nodes, s.index, nil
+}
+
+// service returns the state of a service, m.mu must be held
+func (m *MemoryRegistry) service(serviceName string) *memoryService {
+	s, ok := m.services[serviceName]
+	if !ok {
+		m.index++
+		s = &memoryService{
+			index:   m.index,
+			nodes:   make(map[string]*selector.Node),
+			changed: make(chan struct{}),
+		}
+		m.services[serviceName] = s
+	}
+	return s
+}
+
+// notify wakes up the watchers of a service, m.mu must be held
+func (m *MemoryRegistry) notify(s *memoryService) {
+	m.index++
+	s.index = m.index
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
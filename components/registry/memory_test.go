@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/selector"
+)
+
+func TestMemoryRegistry(t *testing.T) {
+	r := NewMemoryRegistry()
+	ctx := context.Background()
+
+	nodes, index, err := r.Watch(ctx, "helloworld.Greeter", 0)
+	if err != nil || len(nodes) != 0 {
+		t.Fatalf("Watch() = %v, %v", nodes, err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		r.Register(ctx, "helloworld.Greeter", &selector.Node{Address: "127.0.0.1:8000", Weight: 10})
+	}()
+
+	// blocks until the registration
+	nodes, index, err = r.Watch(ctx, "helloworld.Greeter", index)
+	if err != nil || len(nodes) != 1 || nodes[0].Address != "127.0.0.1:8000" || nodes[0].Weight != 10 {
+		t.Fatalf("Watch() = %v, %v", nodes, err)
+	}
+
+	if err := r.Deregister(ctx, "helloworld.Greeter", &selector.Node{Address: "127.0.0.1:8000"}); err != nil {
+		t.Fatal(err)
+	}
+	nodes, _, err = r.Watch(ctx, "helloworld.Greeter", index)
+	if err != nil || len(nodes) != 0 {
+		t.Fatalf("Watch() after deregister = %v, %v", nodes, err)
+	}
+
+	_, index, _ = r.Watch(ctx, "other.Service", 0)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := r.Watch(timeout, "other.Service", index); err == nil {
+		t.Fatal("expected Watch to stop with the context")
+	}
+}
+
+func TestMemoryRegistrySelector(t *testing.T) {
+	r := NewMemoryRegistry()
+	s := NewSelector(r)
+	defer s.Close()
+
+	r.Register(context.Background(), "helloworld.Greeter", &selector.Node{Address: "127.0.0.1:8000"})
+
+	node, done, err := s.Select(context.Background(), "helloworld.Greeter")
+	if err != nil || node.Address != "127.0.0.1:8000" {
+		t.Fatalf("Select() = %v, %v", node, err)
+	}
+	done(selector.DoneInfo{})
+}
+
+func TestMemoryRegistryNamespaces(t *testing.T) {
+	r := NewMemoryRegistry()
+	s := NewSelector(r)
+	defer s.Close()
+
+	ctx := context.Background()
+	r.Register(ctx, selector.ServiceKey("staging", "helloworld.Greeter"), &selector.Node{Address: "127.0.0.1:8000"})
+	r.Register(ctx, selector.ServiceKey("production", "helloworld.Greeter"), &selector.Node{Address: "127.0.0.1:9000"})
+
+	for namespace, addr := range map[string]string{"staging": "127.0.0.1:8000", "production": "127.0.0.1:9000"} {
+		for i := 0; i < 10; i++ {
+			node, _, err := s.Select(ctx, "helloworld.Greeter", selector.WithNamespace(namespace))
+			if err != nil || node.Address != addr {
+				t.Fatalf("Select() in %s = %v, %v", namespace, node, err)
+			}
+		}
+	}
+
+	if _, _, err := s.Select(ctx, "helloworld.Greeter"); err == nil {
+		t.Fatal("expected no node in the default namespace")
+	}
+}
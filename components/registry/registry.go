@@ -0,0 +1,57 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/WeilunZ/zRPC/components/selector"
+)
+
+// Registry defines the standard for service registries. Service instances are
+// described by selector.Node : address, weight and metadata. Service names may be
+// qualified by a namespace, see selector.ServiceKey, instances of different
+// namespaces must not be visible to each other.
+type Registry interface {
+	// Register publishes an instance of a service, registering an address twice updates the instance
+	Register(ctx context.Context, serviceName string, node *selector.Node) error
+	// Deregister removes an instance of a service
+	Deregister(ctx context.Context, serviceName string, node *selector.Node) error
+	// Watch implements selector.Watcher, it blocks until the instances of a service
+	// changed past lastIndex and returns them with the index to pass to the next call
+	Watch(ctx context.Context, serviceName string, lastIndex uint64) ([]*selector.Node, uint64, error)
+}
+
+var registryMap = make(map[string]Registry)
+
+func RegisterRegistry(name string, registry Registry) {
+	if registryMap == nil {
+		registryMap = make(map[string]Registry)
+	}
+	registryMap[name] = registry
+}
+
+func GetRegistry(name string) Registry {
+	if registry, ok := registryMap[name]; ok {
+		return registry
+	}
+	return nil
+}
+
+// NewSelector returns a selector balancing over the instances of the registry,
+// kept up to date by watching it
+func NewSelector(registry Registry) *selector.Cache {
+	return selector.NewCache(&resolver{registry: registry})
+}
+
+// resolver adapts a Registry to selector.Resolver
+type resolver struct {
+	registry Registry
+}
+
+func (r *resolver) Resolve(serviceName string) ([]*selector.Node, error) {
+	nodes, _, err := r.registry.Watch(context.Background(), serviceName, 0)
+	return nodes, err
+}
+
+func (r *resolver) Watch(ctx context.Context, serviceName string, lastIndex uint64) ([]*selector.Node, uint64, error) {
+	return r.registry.Watch(ctx, serviceName, lastIndex)
+}
@@ -1,21 +1,66 @@
 package selector
 
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DefaultWeight is the weight of a node which does not publish one
+const DefaultWeight = 100
+
+// Node is a service instance resolved from the registry
 type Node struct {
-	Key    string
-	Value  []byte
-	weight int
-	Hash   string
+	Key     string            `json:"-"`                 // key of the node in the registry
+	Value   []byte            `json:"-"`                 // raw value stored in the registry
+	Address string            `json:"address"`           // e.g. 127.0.0.1:8000
+	Weight  int               `json:"weight,omitempty"`  // load balancing weight, DefaultWeight if not set
+	Version string            `json:"version,omitempty"` // version of the service running on the node
+	Zone    string            `json:"zone,omitempty"`    // availability zone of the node
+	Tags    map[string]string `json:"tags,omitempty"`    // arbitrary metadata
+	Hash    string            `json:"-"`
+}
+
+// GetWeight returns the load balancing weight of the node
+func (n *Node) GetWeight() int {
+	if n.Weight <= 0 {
+		return DefaultWeight
+	}
+	return n.Weight
+}
+
+// id identifies the node among the nodes of a service
+func (n *Node) id() string {
+	if n.Key != "" {
+		return n.Key
+	}
+	return n.Address
 }
 
 type Balancer interface {
 	Balance(serviceName string, nodes []*Node) *Node
 }
 
+// DoneInfo describes how a call made to a balanced node went
+type DoneInfo struct {
+	Err     error         // error returned by the call, nil if it succeeded
+	Latency time.Duration // time elapsed between picking the node and the call returning
+}
+
+// FeedbackBalancer is implemented by balancers that learn from call results.
+// Pick works like Balance, the returned done func must be called exactly once when the call finishes.
+type FeedbackBalancer interface {
+	Balancer
+	Pick(serviceName string, nodes []*Node) (*Node, func(DoneInfo))
+}
+
 var (
 	balancerMap                = make(map[string]Balancer, 0)
+	balancerMu                 sync.RWMutex
 	DefaultLoadBalancer        = newRandomBalancer()
 	RoundRobinBalancer         = newRoundRobinBalancer()
 	WeightedRoundRobinBalancer = newWeightedRoundRobinBalancer()
+	P2CBalancer                = newP2CBalancer()
 )
 
 const (
@@ -23,24 +68,68 @@ const (
 	RoundRobin         = "roundRobin"
 	WeightedRoundRobin = "weightedRoundRobin"
 	ConsistentHash     = "consistentHash"
+	P2C                = "p2c"
 )
 
 func init() {
 	RegisterBalancer(Random, DefaultLoadBalancer)
 	RegisterBalancer(RoundRobin, RoundRobinBalancer)
 	RegisterBalancer(WeightedRoundRobin, WeightedRoundRobinBalancer)
+	RegisterBalancer(P2C, P2CBalancer)
 }
 
+// RegisterBalancer registers a balancer under name, registered balancers are told about the
+// nodes of the services resolved by the cache
 func RegisterBalancer(name string, balancer Balancer) {
-	if balancerMap == nil {
-		balancerMap = make(map[string]Balancer)
-	}
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	balancerMu.Lock()
 	balancerMap[name] = balancer
+	balancerMu.Unlock()
+	seedBalancer(balancer)
 }
 
 func GetBalancer(name string) Balancer {
+	balancerMu.RLock()
+	defer balancerMu.RUnlock()
 	if balancer, ok := balancerMap[name]; ok {
 		return balancer
 	}
 	return DefaultLoadBalancer
 }
+
+// balancers returns the registered balancers
+func balancers() []Balancer {
+	balancerMu.RLock()
+	defer balancerMu.RUnlock()
+	all := make([]Balancer, 0, len(balancerMap))
+	for _, balancer := range balancerMap {
+		all = append(all, balancer)
+	}
+	return all
+}
+
+// Pick picks a node with the given balancer, balancers without feedback get a no-op done func
+func Pick(balancer Balancer, serviceName string, nodes []*Node) (*Node, func(DoneInfo)) {
+	if fb, ok := balancer.(FeedbackBalancer); ok {
+		return fb.Pick(serviceName, nodes)
+	}
+	return balancer.Balance(serviceName, nodes), func(DoneInfo) {}
+}
+
+// lockedRand is a goroutine-safe random source shared by the balancers, seeded once
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+var globalRand = &lockedRand{
+	r: rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Intn(n)
+}
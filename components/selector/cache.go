@@ -0,0 +1,241 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/log"
+)
+
+const (
+	defaultPollInterval = 10 * time.Second // refresh interval of resolvers which cannot watch
+	minRetryBackoff     = 500 * time.Millisecond
+	maxRetryBackoff     = 30 * time.Second
+)
+
+var ErrCacheClosed = errors.New("resolver cache closed")
+
+// Cache keeps the nodes of every service resolved through it, so that selecting a node
+// does not cost a registry round trip. Resolvers implementing Watcher keep the cache up to
+// date through blocking queries, others are polled. When the registry is unreachable the
+// cache keeps serving the last known good nodes.
+// Cache implements Selector by balancing over the cached nodes.
+type Cache struct {
+	resolver     Resolver
+	pollInterval time.Duration
+	entries      *sync.Map // serviceName -> *cacheEntry
+	ctx          context.Context
+	cancel       context.CancelFunc
+}
+
+type cacheEntry struct {
+	serviceName string
+	ready       chan struct{} // closed once the first resolution completed
+	once        sync.Once
+
+	mu    sync.RWMutex
+	nodes []*Node
+	err   error // error of the last resolution, nil if it succeeded
+}
+
+func NewCache(resolver Resolver) *Cache {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Cache{
+		resolver:     resolver,
+		pollInterval: defaultPollInterval,
+		entries:      new(sync.Map),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Nodes returns the cached nodes of a service, the first call for a service
+// waits for it to be resolved and starts watching it
+func (c *Cache) Nodes(ctx context.Context, serviceName string) ([]*Node, error) {
+	e := c.entry(serviceName)
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.ctx.Done():
+		return nil, ErrCacheClosed
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if len(e.nodes) == 0 && e.err != nil {
+		return nil, e.err
+	}
+	return e.nodes, nil
+}
+
+func (c *Cache) Select(ctx context.Context, serviceName string, opts ...Option) (*Node, func(DoneInfo), error) {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	serviceName = ServiceKey(o.Namespace, serviceName)
+	nodes, err := c.Nodes(ctx, serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := serviceName
+	if len(o.Filters) > 0 {
+		all := len(nodes)
+		for _, filter := range o.Filters {
+			nodes = filter(ctx, nodes)
+		}
+		// balancers keep their state per key, each subset of nodes gets its own
+		if len(nodes) != all {
+			key = subsetKey(serviceName, nodes)
+		}
+	}
+
+	node, done := Pick(GetBalancer(o.Balancer), key, nodes)
+	if node == nil {
+		return nil, nil, fmt.Errorf("%w for service %s", ErrNoNodes, serviceName)
+	}
+	return node, done, nil
+}
+
+// List returns the nodes of a service the filters of the options leave
+func (c *Cache) List(ctx context.Context, serviceName string, opts ...Option) ([]*Node, error) {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	nodes, err := c.Nodes(ctx, ServiceKey(o.Namespace, serviceName))
+	if err != nil {
+		return nil, err
+	}
+	for _, filter := range o.Filters {
+		nodes = filter(ctx, nodes)
+	}
+	return nodes, nil
+}
+
+// subsetKey identifies a subset of the nodes of a service
+func subsetKey(serviceName string, nodes []*Node) string {
+	h := fnv.New64a()
+	for _, node := range nodes {
+		h.Write([]byte(node.id()))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s#%x", serviceName, h.Sum64())
+}
+
+// deleteServiceKeys deletes the entries of a service and of all its subsets from m
+func deleteServiceKeys(m *sync.Map, serviceName string) {
+	m.Range(func(key, _ interface{}) bool {
+		if balancedService(key.(string)) == serviceName {
+			m.Delete(key)
+		}
+		return true
+	})
+}
+
+// Close stops watching all services
+func (c *Cache) Close() {
+	c.cancel()
+}
+
+func (c *Cache) entry(serviceName string) *cacheEntry {
+	if e, ok := c.entries.Load(serviceName); ok {
+		return e.(*cacheEntry)
+	}
+	e, loaded := c.entries.LoadOrStore(serviceName, &cacheEntry{
+		serviceName: serviceName,
+		ready:       make(chan struct{}),
+	})
+	if !loaded {
+		go c.watch(e.(*cacheEntry))
+	}
+	return e.(*cacheEntry)
+}
+
+func (c *Cache) watch(e *cacheEntry) {
+	var (
+		index    uint64
+		resolved bool
+		backoff  = minRetryBackoff
+	)
+
+	for {
+		var (
+			nodes    []*Node
+			newIndex uint64
+			err      error
+		)
+
+		if w, ok := c.resolver.(Watcher); ok {
+			nodes, newIndex, err = w.Watch(c.ctx, e.serviceName, index)
+		} else {
+			if resolved && !c.sleep(c.pollInterval) {
+				return
+			}
+			nodes, err = c.resolver.Resolve(e.serviceName)
+		}
+
+		if c.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.Errorf("resolve service %s error, serving the last known nodes, %v", e.serviceName, err)
+			e.fail(err)
+			if !c.sleep(backoff) {
+				return
+			}
+			if backoff *= 2; backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+			continue
+		}
+		backoff = minRetryBackoff
+
+		// a blocking query which timed out without any change
+		if resolved && newIndex != 0 && newIndex == index {
+			continue
+		}
+		index = newIndex
+		resolved = true
+
+		e.update(nodes)
+		notifyBalancers(e.serviceName, nodes)
+	}
+}
+
+func (c *Cache) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+func (e *cacheEntry) update(nodes []*Node) {
+	e.mu.Lock()
+	e.nodes = nodes
+	e.err = nil
+	e.mu.Unlock()
+	e.once.Do(func() { close(e.ready) })
+}
+
+// fail records the error but keeps the last known good nodes
+func (e *cacheEntry) fail(err error) {
+	e.mu.Lock()
+	e.err = err
+	e.mu.Unlock()
+	e.once.Do(func() { close(e.ready) })
+}
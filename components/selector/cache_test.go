@@ -0,0 +1,146 @@
+package selector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRegistry implements Watcher on top of an in-memory node list
+type fakeRegistry struct {
+	mu      sync.Mutex
+	nodes   []*Node
+	index   uint64
+	err     error
+	changed chan struct{}
+	calls   int
+}
+
+func newFakeRegistry(nodes ...*Node) *fakeRegistry {
+	return &fakeRegistry{nodes: nodes, index: 1, changed: make(chan struct{})}
+}
+
+func (f *fakeRegistry) set(err error, nodes ...*Node) {
+	f.mu.Lock()
+	f.nodes, f.err = nodes, err
+	f.index++
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.mu.Unlock()
+}
+
+func (f *fakeRegistry) Resolve(serviceName string) ([]*Node, error) {
+	nodes, _, err := f.Watch(context.Background(), serviceName, 0)
+	return nodes, err
+}
+
+func (f *fakeRegistry) Watch(ctx context.Context, serviceName string, lastIndex uint64) ([]*Node, uint64, error) {
+	f.mu.Lock()
+	f.calls++
+	if f.index == lastIndex {
+		changed := f.changed
+		f.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, lastIndex, ctx.Err()
+		}
+		f.mu.Lock()
+	}
+	defer f.mu.Unlock()
+	return f.nodes, f.index, f.err
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCacheServesLastKnownGoodNodes(t *testing.T) {
+	registry := newFakeRegistry(&Node{Address: "127.0.0.1:8000"})
+	cache := NewCache(registry)
+	defer cache.Close()
+
+	nodes, err := cache.Nodes(context.Background(), "svc")
+	if err != nil || len(nodes) != 1 {
+		t.Fatalf("Nodes() = %v, %v", nodes, err)
+	}
+
+	registry.set(nil, &Node{Address: "127.0.0.1:8000"}, &Node{Address: "127.0.0.1:8001"})
+	waitFor(t, func() bool {
+		nodes, _ := cache.Nodes(context.Background(), "svc")
+		return len(nodes) == 2
+	})
+
+	// the registry goes down, the cache keeps the previous nodes
+	registry.set(errors.New("registry unreachable"))
+	time.Sleep(50 * time.Millisecond)
+	nodes, err = cache.Nodes(context.Background(), "svc")
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("Nodes() during outage = %v, %v", nodes, err)
+	}
+
+	// one resolution serves all calls
+	registry.mu.Lock()
+	calls := registry.calls
+	registry.mu.Unlock()
+	for i := 0; i < 100; i++ {
+		cache.Nodes(context.Background(), "svc")
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if registry.calls > calls+1 {
+		t.Fatalf("registry queried %d times for cached calls", registry.calls-calls)
+	}
+}
+
+func TestCacheFirstResolutionError(t *testing.T) {
+	registry := newFakeRegistry()
+	registry.err = errors.New("registry unreachable")
+	cache := NewCache(registry)
+	defer cache.Close()
+
+	if _, err := cache.Nodes(context.Background(), "svc"); err == nil {
+		t.Fatal("expected the resolution error")
+	}
+}
+
+func TestCacheSelect(t *testing.T) {
+	cache := NewCache(newFakeRegistry(&Node{Address: "127.0.0.1:8000"}, &Node{Address: "127.0.0.1:8001"}))
+	defer cache.Close()
+
+	node, done, err := cache.Select(context.Background(), "svc", WithBalancerName(P2C))
+	if err != nil || node == nil {
+		t.Fatalf("Select() = %v, %v", node, err)
+	}
+	done(DoneInfo{Latency: time.Millisecond})
+
+	empty := NewCache(newFakeRegistry())
+	defer empty.Close()
+	if _, _, err := empty.Select(context.Background(), "svc"); !errors.Is(err, ErrNoNodes) {
+		t.Fatalf("Select() on an empty service = %v, want ErrNoNodes", err)
+	}
+}
+
+func TestCacheList(t *testing.T) {
+	nodes := []*Node{{Address: "127.0.0.1:8000", Zone: "az1"}, {Address: "127.0.0.1:8001", Zone: "az2"}}
+	c := NewCache(newFakeRegistry(nodes...))
+	defer c.Close()
+
+	all, err := c.List(context.Background(), "helloworld.Greeter")
+	if err != nil || len(all) != 2 {
+		t.Fatalf("List() = %v, %v", all, err)
+	}
+
+	local, err := c.List(context.Background(), "helloworld.Greeter", WithFilter(NewZoneFilter("az1", 1)))
+	if err != nil || len(local) != 1 || local[0].Zone != "az1" {
+		t.Fatalf("List() in az1 = %v, %v", local, err)
+	}
+}
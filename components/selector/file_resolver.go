@@ -0,0 +1,116 @@
+package selector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/log"
+)
+
+const File = "file"
+
+// interval at which the file is checked for changes
+const defaultFileCheckInterval = time.Second
+
+// fileResolver resolves services from a json file mapping service names to nodes, e.g. :
+//
+//	{
+//	    "helloworld.Greeter": [
+//	        {"address": "127.0.0.1:8000", "weight": 200, "zone": "az1", "tags": {"env": "dev"}},
+//	        {"address": "127.0.0.1:8001"}
+//	    ]
+//	}
+//
+// Services of a namespace are keyed by their qualified name, e.g. staging/helloworld.Greeter.
+// Changes of the file are picked up by Watch.
+type fileResolver struct {
+	path          string
+	checkInterval time.Duration
+}
+
+// NewFileResolver returns a Resolver reading the json file at path
+func NewFileResolver(path string) Resolver {
+	return &fileResolver{
+		path:          path,
+		checkInterval: defaultFileCheckInterval,
+	}
+}
+
+func (f *fileResolver) Resolve(serviceName string) ([]*Node, error) {
+	nodes, _, err := f.load(serviceName)
+	return nodes, err
+}
+
+// RegisterFileSelector registers under name the selector of the nodes of the json file at path,
+// e.g. to be used with client.WithSelectorName(name)
+func RegisterFileSelector(name, path string) Selector {
+	selector := NewCache(NewFileResolver(path))
+	RegisterSelector(name, selector)
+	return selector
+}
+
+// Watch polls the modification time of the file, which is used as index. Once loaded, a file which
+// cannot be loaded any more, e.g. while being written, is retried on the next tick, write the file
+// to a temporary one renamed into place to publish it at once. The first load fails with its error.
+func (f *fileResolver) Watch(ctx context.Context, serviceName string, lastIndex uint64) ([]*Node, uint64, error) {
+	ticker := time.NewTicker(f.checkInterval)
+	defer ticker.Stop()
+
+	var failedIndex uint64 // index of the last file which could not be loaded, logged once
+	for {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			return nil, lastIndex, err
+		}
+		if index := fileIndex(info); index != lastIndex {
+			nodes, loadedIndex, err := f.load(serviceName)
+			if err == nil || lastIndex == 0 {
+				return nodes, loadedIndex, err
+			}
+			if index != failedIndex {
+				failedIndex = index
+				log.Errorf("endpoints file reload error, %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, lastIndex, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *fileResolver) load(serviceName string) ([]*Node, uint64, error) {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	services := make(map[string][]*Node)
+	if err := json.Unmarshal(data, &services); err != nil {
+		return nil, 0, fmt.Errorf("parse endpoints file %s error, %v", f.path, err)
+	}
+
+	nodes := services[serviceName]
+	for _, node := range nodes {
+		if node.Address == "" {
+			return nil, 0, fmt.Errorf("endpoints file %s, node of %s without address", f.path, serviceName)
+		}
+		node.Key = node.Address
+	}
+	return nodes, fileIndex(info), nil
+}
+
+func fileIndex(info os.FileInfo) uint64 {
+	return uint64(info.ModTime().UnixNano()) ^ uint64(info.Size())
+}
@@ -0,0 +1,106 @@
+package selector
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "endpoints.json")
+	// the file is replaced at once so that it is never read half written
+	write := func(content string, mtime time.Time) {
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, []byte(content), 0644); err != nil {
+			t.Error(err)
+			return
+		}
+		os.Chtimes(tmp, mtime, mtime)
+		if err := os.Rename(tmp, path); err != nil {
+			t.Error(err)
+		}
+	}
+	now := time.Now()
+	write(`{"helloworld.Greeter": [{"address": "127.0.0.1:8000", "weight": 200, "tags": {"env": "dev"}}]}`, now)
+
+	r := NewFileResolver(path).(*fileResolver)
+	r.checkInterval = 5 * time.Millisecond
+
+	nodes, index, err := r.Watch(context.Background(), "helloworld.Greeter", 0)
+	if err != nil || len(nodes) != 1 || nodes[0].Weight != 200 || nodes[0].Tags["env"] != "dev" {
+		t.Fatalf("Watch() = %v, %v", nodes, err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		write(`{"helloworld.Greeter": [{"address": "127.0.0.1:8000"}, {"address": "127.0.0.1:8001"}]}`, now.Add(time.Second))
+	}()
+	nodes, _, err = r.Watch(context.Background(), "helloworld.Greeter", index)
+	if err != nil || len(nodes) != 2 {
+		t.Fatalf("Watch() after change = %v, %v", nodes, err)
+	}
+
+	// a file which does not parse is retried until it is fixed
+	write(`{"helloworld.Greeter": [`, now.Add(2*time.Second))
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		write(`{"helloworld.Greeter": [{"address": "127.0.0.1:8002"}]}`, now.Add(3*time.Second))
+	}()
+	nodes, _, err = r.Watch(context.Background(), "helloworld.Greeter", index)
+	if err != nil || len(nodes) != 1 || nodes[0].Address != "127.0.0.1:8002" {
+		t.Fatalf("Watch() after an invalid file = %v, %v", nodes, err)
+	}
+
+	if nodes, err := r.Resolve("unknown.Service"); err != nil || len(nodes) != 0 {
+		t.Fatalf("Resolve() of an unknown service = %v, %v", nodes, err)
+	}
+
+	// the first load of a file which does not parse fails
+	write(`{"helloworld.Greeter": [`, now.Add(4*time.Second))
+	if _, _, err := r.Watch(context.Background(), "helloworld.Greeter", 0); err == nil {
+		t.Fatal("Watch() of an invalid file succeeded")
+	}
+}
+
+func TestRegisterFileSelector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "endpoints.json")
+	if err := ioutil.WriteFile(path, []byte(`{"helloworld.Greeter": [{"address": "127.0.0.1:8000"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := RegisterFileSelector("file-test", path).(*Cache)
+	defer s.Close()
+	if GetSelector("file-test") != s {
+		t.Fatal("expected the file selector to be registered")
+	}
+	node, done, err := s.Select(context.Background(), "helloworld.Greeter")
+	if err != nil || node.Address != "127.0.0.1:8000" {
+		t.Fatalf("Select() = %v, %v", node, err)
+	}
+	done(DoneInfo{})
+
+	// services of a file which does not parse fail instead of waiting for it to be fixed
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := ioutil.WriteFile(invalid, []byte(`{`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCache(NewFileResolver(invalid))
+	defer c.Close()
+	if _, err := c.Nodes(context.Background(), "helloworld.Greeter"); err == nil {
+		t.Fatal("Nodes() of an invalid file succeeded")
+	}
+}
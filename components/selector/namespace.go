@@ -0,0 +1,22 @@
+package selector
+
+import "strings"
+
+// ServiceKey qualifies a service name by its namespace, e.g. staging/helloworld.Greeter.
+// Services of the default namespace "" keep their plain name. Registries and resolvers
+// receive the qualified name, so that namespaces partition registration and resolution.
+func ServiceKey(namespace, serviceName string) string {
+	if namespace == "" {
+		return serviceName
+	}
+	return namespace + "/" + serviceName
+}
+
+// SplitServiceKey splits a qualified service name into its namespace and service name
+func SplitServiceKey(key string) (namespace, serviceName string) {
+	idx := strings.Index(key, "/")
+	if idx == -1 {
+		return "", key
+	}
+	return key[:idx], key[idx+1:]
+}
@@ -0,0 +1,176 @@
+package selector
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultDecay   = 10 * time.Second       // time constant of the latency ewma
+	initialLag     = 10 * time.Millisecond  // latency assumed for a node without any sample
+	failurePenalty = 250 * time.Millisecond // latency recorded for a failed call
+)
+
+// p2cBalancer implements the power of two choices algorithm : it picks two random nodes
+// and sends the request to the less loaded one. The load of a node is the ewma of its
+// latency multiplied by the number of requests in flight on it, divided by its weight.
+type p2cBalancer struct {
+	stats  *sync.Map     // balancing key -> *sync.Map of node id -> *nodeStat
+	decay  time.Duration // time constant of the latency ewma
+	warmup *warmup
+}
+
+type nodeStat struct {
+	inflight int64 // requests in flight, accessed atomically
+
+	mu    sync.Mutex
+	lag   float64 // ewma of latency in nanoseconds
+	stamp int64   // unix nano of the last sample, 0 if none
+}
+
+// NewP2CBalancer returns a power of two choices balancer
+func NewP2CBalancer(opts ...BalancerOption) Balancer {
+	return newP2CBalancer(opts...)
+}
+
+func newP2CBalancer(opts ...BalancerOption) *p2cBalancer {
+	o := &BalancerOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &p2cBalancer{
+		stats:  new(sync.Map),
+		decay:  defaultDecay,
+		warmup: newWarmup(o),
+	}
+}
+
+func (p *p2cBalancer) Balance(serviceName string, nodes []*Node) *Node {
+	node, _ := p.pick(serviceName, nodes)
+	return node
+}
+
+func (p *p2cBalancer) Pick(serviceName string, nodes []*Node) (*Node, func(DoneInfo)) {
+	node, stat := p.pick(serviceName, nodes)
+	if node == nil {
+		return nil, func(DoneInfo) {}
+	}
+
+	atomic.AddInt64(&stat.inflight, 1)
+	start := time.Now()
+	var once sync.Once
+
+	return node, func(info DoneInfo) {
+		once.Do(func() {
+			atomic.AddInt64(&stat.inflight, -1)
+			latency := info.Latency
+			if latency <= 0 {
+				latency = time.Since(start)
+			}
+			if info.Err != nil && latency < failurePenalty {
+				latency = failurePenalty
+			}
+			stat.observe(latency, p.decay)
+		})
+	}
+}
+
+func (p *p2cBalancer) pick(serviceName string, nodes []*Node) (*Node, *nodeStat) {
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nodes[0], p.stat(serviceName, nodes[0])
+	}
+
+	a := globalRand.Intn(len(nodes))
+	b := globalRand.Intn(len(nodes) - 1)
+	if b >= a {
+		b++
+	}
+
+	statA, statB := p.stat(serviceName, nodes[a]), p.stat(serviceName, nodes[b])
+	if statB.load()/p.weight(serviceName, nodes[b]) < statA.load()/p.weight(serviceName, nodes[a]) {
+		return nodes[b], statB
+	}
+	return nodes[a], statA
+}
+
+// weight returns the weight of the node, reduced while it warms up
+func (p *p2cBalancer) weight(serviceName string, node *Node) float64 {
+	return float64(node.GetWeight()) * p.warmup.factor(serviceName, node)
+}
+
+func (p *p2cBalancer) stat(serviceName string, node *Node) *nodeStat {
+	m, ok := p.stats.Load(serviceName)
+	if !ok {
+		m, _ = p.stats.LoadOrStore(serviceName, new(sync.Map))
+	}
+	stats := m.(*sync.Map)
+
+	if s, ok := stats.Load(node.id()); ok {
+		return s.(*nodeStat)
+	}
+	s, _ := stats.LoadOrStore(node.id(), &nodeStat{})
+	return s.(*nodeStat)
+}
+
+// observe folds a latency sample into the ewma, older samples decay with the time elapsed since
+func (s *nodeStat) observe(latency time.Duration, decay time.Duration) {
+	now := time.Now().UnixNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stamp == 0 {
+		s.lag = float64(latency)
+	} else {
+		td := now - s.stamp
+		if td < 0 {
+			td = 0
+		}
+		w := math.Exp(-float64(td) / float64(decay))
+		s.lag = s.lag*w + float64(latency)*(1-w)
+	}
+	s.stamp = now
+}
+
+func (s *nodeStat) load() float64 {
+	s.mu.Lock()
+	lag := s.lag
+	if s.stamp == 0 {
+		lag = float64(initialLag)
+	}
+	s.mu.Unlock()
+
+	return lag * float64(atomic.LoadInt64(&s.inflight)+1)
+}
+
+// Update drops the stats of the nodes which left the service and the stats of its subsets
+func (p *p2cBalancer) Update(serviceName string, nodes []*Node) {
+	p.warmup.update(serviceName, nodes)
+
+	alive := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		alive[node.id()] = true
+	}
+	p.stats.Range(func(key, value interface{}) bool {
+		// subsets of the service are balanced under their own key, they change with the nodes
+		if balancedService(key.(string)) != serviceName {
+			return true
+		}
+		if key.(string) != serviceName {
+			p.stats.Delete(key)
+			return true
+		}
+		value.(*sync.Map).Range(func(id, _ interface{}) bool {
+			if !alive[id.(string)] {
+				value.(*sync.Map).Delete(id)
+			}
+			return true
+		})
+		return true
+	})
+}
@@ -0,0 +1,77 @@
+package selector
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestP2CBalancerPrefersFastNode(t *testing.T) {
+	b := newP2CBalancer()
+	nodes := []*Node{{Key: "fast"}, {Key: "slow"}}
+	latency := map[string]time.Duration{
+		"fast": time.Millisecond,
+		"slow": 100 * time.Millisecond,
+	}
+
+	// warm up both nodes
+	for _, n := range nodes {
+		b.stat("svc", n).observe(latency[n.Key], b.decay)
+	}
+
+	picked := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		node, done := b.Pick("svc", nodes)
+		picked[node.Key]++
+		done(DoneInfo{Latency: latency[node.Key]})
+	}
+	if picked["fast"] <= picked["slow"] {
+		t.Fatalf("expected fast node to be preferred, got %v", picked)
+	}
+}
+
+func TestP2CBalancerInflight(t *testing.T) {
+	b := newP2CBalancer()
+	nodes := []*Node{{Key: "a"}, {Key: "b"}}
+
+	// a call hanging on a keeps it loaded, b must be picked
+	node, done := b.Pick("svc", nodes)
+	for i := 0; i < 10; i++ {
+		other, otherDone := b.Pick("svc", nodes)
+		if other == node {
+			t.Fatalf("expected the idle node to be picked")
+		}
+		otherDone(DoneInfo{Latency: initialLag})
+	}
+	done(DoneInfo{Err: errors.New("failed")})
+	done(DoneInfo{})
+
+	if inflight := b.stat("svc", node).inflight; inflight != 0 {
+		t.Fatalf("inflight = %d, want 0", inflight)
+	}
+}
+
+func TestP2CBalancerConcurrent(t *testing.T) {
+	b := newP2CBalancer()
+	nodes := []*Node{{Key: "a"}, {Key: "b"}, {Key: "c"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				_, done := b.Pick("svc", nodes)
+				done(DoneInfo{Latency: time.Millisecond})
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, n := range nodes {
+		if inflight := b.stat("svc", n).inflight; inflight != 0 {
+			t.Fatalf("node %s inflight = %d, want 0", n.Key, inflight)
+		}
+	}
+}
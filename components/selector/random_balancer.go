@@ -1,10 +1,5 @@
 package selector
 
-import (
-	"math/rand"
-	"time"
-)
-
 type randomBalancer struct {
 }
 
@@ -16,7 +11,6 @@ func (r *randomBalancer) Balance(serviceName string, nodes []*Node) *Node {
 	if len(nodes) == 0 {
 		return nil
 	}
-	rand.Seed(time.Now().Unix())
-	num := rand.Intn(len(nodes))
+	num := globalRand.Intn(len(nodes))
 	return nodes[num]
 }
@@ -0,0 +1,54 @@
+package selector
+
+import (
+	"context"
+	"sync"
+)
+
+// Resolver looks up the nodes of a service in a registry
+type Resolver interface {
+	Resolve(serviceName string) ([]*Node, error)
+}
+
+// Watcher is implemented by resolvers which can block until the nodes of a service change.
+// Watch returns once the registry index moved past lastIndex or its wait time expired,
+// together with the index to pass to the next call. A lastIndex of 0 returns immediately.
+type Watcher interface {
+	Watch(ctx context.Context, serviceName string, lastIndex uint64) ([]*Node, uint64, error)
+}
+
+// Updater is implemented by balancers which keep per node state,
+// they are told about the new nodes of a service every time the registry changes
+type Updater interface {
+	Update(serviceName string, nodes []*Node)
+}
+
+var (
+	notifyMu sync.Mutex                 // orders the updates and the registrations of balancers
+	notified = make(map[string][]*Node) // serviceName -> nodes last pushed to the balancers
+)
+
+// notifyBalancers pushes the new nodes of a service to all registered balancers
+func notifyBalancers(serviceName string, nodes []*Node) {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	notified[serviceName] = nodes
+	for _, balancer := range balancers() {
+		if u, ok := balancer.(Updater); ok {
+			u.Update(serviceName, nodes)
+		}
+	}
+}
+
+// seedBalancer tells a balancer registered after the services were resolved about their nodes,
+// so that it tells the nodes joining later apart from them. notifyMu must be held.
+func seedBalancer(balancer Balancer) {
+	u, ok := balancer.(Updater)
+	if !ok {
+		return
+	}
+	for serviceName, nodes := range notified {
+		u.Update(serviceName, nodes)
+	}
+}
@@ -63,3 +63,8 @@ func (r *roundRobinBalancer) Balance(serviceName string, nodes []*Node) *Node {
 	r.pickers.Store(serviceName, picker)
 	return node
 }
+
+// Update resets the pickers of a service whose nodes changed, and of its subsets
+func (r *roundRobinBalancer) Update(serviceName string, nodes []*Node) {
+	deleteServiceKeys(r.pickers, serviceName)
+}
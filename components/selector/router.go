@@ -0,0 +1,110 @@
+package selector
+
+import (
+	"context"
+
+	"github.com/WeilunZ/zRPC/components/metadata"
+)
+
+// Filter narrows down the nodes a balancer picks from for a call, it must not modify nodes
+type Filter func(ctx context.Context, nodes []*Node) []*Node
+
+// Route sends the calls matching its labels to the nodes of its destinations
+type Route struct {
+	Match        map[string]string // metadata the call must carry, e.g. x-canary : true, every call matches if empty
+	Destinations []Destination     // weighted split of the matching calls
+}
+
+// Destination is a subset of nodes and its share of the calls of a route
+type Destination struct {
+	Tags   map[string]string // metadata of the nodes, the "version" and "zone" keys match the node fields
+	Weight int               // relative share of the calls, e.g. 90 and 10 for a 10% canary
+}
+
+// NewRouter returns a Filter applying the first route matching the metadata of the call.
+// Calls matching no route, or whose destination has no node, are balanced over all nodes.
+func NewRouter(routes ...Route) Filter {
+	return func(ctx context.Context, nodes []*Node) []*Node {
+		md := metadata.ClientMetadata(ctx)
+		for _, route := range routes {
+			if !route.matches(md) {
+				continue
+			}
+			dest := route.pick()
+			if dest == nil {
+				return nodes
+			}
+			if matched := dest.filter(nodes); len(matched) > 0 {
+				return matched
+			}
+			return nodes
+		}
+		return nodes
+	}
+}
+
+func (r *Route) matches(md metadata.MD) bool {
+	for k, v := range r.Match {
+		if md.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// pick draws a destination according to the weights
+func (r *Route) pick() *Destination {
+	total := 0
+	for _, d := range r.Destinations {
+		if d.Weight > 0 {
+			total += d.Weight
+		}
+	}
+	if total == 0 {
+		if len(r.Destinations) == 0 {
+			return nil
+		}
+		return &r.Destinations[0]
+	}
+
+	n := globalRand.Intn(total)
+	for i := range r.Destinations {
+		if r.Destinations[i].Weight <= 0 {
+			continue
+		}
+		if n -= r.Destinations[i].Weight; n < 0 {
+			return &r.Destinations[i]
+		}
+	}
+	return nil
+}
+
+func (d *Destination) filter(nodes []*Node) []*Node {
+	var matched []*Node
+	for _, node := range nodes {
+		if node.MatchTags(d.Tags) {
+			matched = append(matched, node)
+		}
+	}
+	return matched
+}
+
+// MatchTags reports whether the node carries all the tags, the "version"
+// and "zone" keys match the Version and Zone fields of the node
+func (n *Node) MatchTags(tags map[string]string) bool {
+	for k, v := range tags {
+		var value string
+		switch k {
+		case "version":
+			value = n.Version
+		case "zone":
+			value = n.Zone
+		default:
+			value = n.Tags[k]
+		}
+		if value != v {
+			return false
+		}
+	}
+	return true
+}
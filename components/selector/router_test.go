@@ -0,0 +1,52 @@
+package selector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/WeilunZ/zRPC/components/metadata"
+)
+
+func TestRouter(t *testing.T) {
+	nodes := []*Node{
+		{Address: "127.0.0.1:8000", Version: "v1"},
+		{Address: "127.0.0.1:8001", Version: "v1"},
+		{Address: "127.0.0.1:8002", Version: "v2", Tags: map[string]string{"env": "canary"}},
+	}
+	router := NewRouter(
+		Route{
+			Match:        map[string]string{"x-canary": "true"},
+			Destinations: []Destination{{Tags: map[string]string{"env": "canary"}}},
+		},
+		Route{
+			Destinations: []Destination{
+				{Tags: map[string]string{"version": "v1"}, Weight: 90},
+				{Tags: map[string]string{"version": "v2"}, Weight: 10},
+			},
+		},
+	)
+
+	canary := metadata.WithClientMetadata(context.Background(), metadata.MD{"x-canary": "true"})
+	if got := router(canary, nodes); len(got) != 1 || got[0].Address != "127.0.0.1:8002" {
+		t.Fatalf("canary call routed to %v", got)
+	}
+
+	v2 := 0
+	for i := 0; i < 1000; i++ {
+		got := router(context.Background(), nodes)
+		if len(got) == 1 && got[0].Version == "v2" {
+			v2++
+		} else if len(got) != 2 {
+			t.Fatalf("call routed to %v", got)
+		}
+	}
+	if v2 < 50 || v2 > 150 {
+		t.Fatalf("%d calls out of 1000 routed to v2, want about 100", v2)
+	}
+
+	// destinations without nodes fall back to all nodes
+	empty := NewRouter(Route{Destinations: []Destination{{Tags: map[string]string{"version": "v3"}}}})
+	if got := empty(context.Background(), nodes); len(got) != len(nodes) {
+		t.Fatalf("call routed to %v, want all nodes", got)
+	}
+}
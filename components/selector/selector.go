@@ -1,40 +1,140 @@
 package selector
 
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Selector picks the node serving a call. The returned done func must be called exactly once
+// with the result of the call, so that balancers can learn from it.
 type Selector interface {
-	Select(string) (string, error)
+	Select(ctx context.Context, serviceName string, opts ...Option) (*Node, func(DoneInfo), error)
+}
+
+// Lister is implemented by the selectors able to list all the nodes of a service,
+// e.g. to broadcast a call to every node. The returned nodes must not be modified.
+type Lister interface {
+	List(ctx context.Context, serviceName string, opts ...Option) ([]*Node, error)
 }
 
 type defaultSelector struct {
 }
 
+// Options defines the parameters of a single selection
 type Options struct {
+	Balancer  string   // balancer name, e.g. : random、roundRobin、p2c
+	Filters   []Filter // applied in order to the nodes before balancing
+	Namespace string   // namespace the service is resolved in, the default namespace if empty
 }
 
 type Option func(*Options)
 
+// WithBalancerName returns an Option which sets the balancer picking the node
+func WithBalancerName(balancer string) Option {
+	return func(o *Options) {
+		o.Balancer = balancer
+	}
+}
+
+// WithFilter returns an Option which adds filters narrowing down the nodes before balancing
+func WithFilter(filters ...Filter) Option {
+	return func(o *Options) {
+		o.Filters = append(o.Filters, filters...)
+	}
+}
+
+// WithNamespace returns an Option which resolves the service in the given namespace
+func WithNamespace(namespace string) Option {
+	return func(o *Options) {
+		o.Namespace = namespace
+	}
+}
+
+var ErrNoNodes = errors.New("no nodes available")
+
+type nodeKey struct{}
+
+// WithNode returns a context sending the calls made with it to node, bypassing the selection
+func WithNode(ctx context.Context, node *Node) context.Context {
+	return context.WithValue(ctx, nodeKey{}, node)
+}
+
+// NodeFromContext returns the node the calls made with ctx are sent to, if any
+func NodeFromContext(ctx context.Context) (*Node, bool) {
+	node, ok := ctx.Value(nodeKey{}).(*Node)
+	return node, ok
+}
+
 func init() {
 	RegisterSelector("default", DefaultSelector)
 }
 
 var DefaultSelector = &defaultSelector{}
 
-var selectorMap = make(map[string]Selector)
+var (
+	selectorMap = make(map[string]Selector)
+	selectorMu  sync.RWMutex
+)
 
 func RegisterSelector(name string, selector Selector) {
+	selectorMu.Lock()
+	defer selectorMu.Unlock()
 	if selectorMap == nil {
 		selectorMap = make(map[string]Selector)
 	}
 	selectorMap[name] = selector
 }
 
-func (d *defaultSelector) Select(serviceName string) (string, error) {
-	// 会基于服务发现的第三方库如zookeeper,consul,etcd等实现，此处忽略
-	return "", nil
+// defaultSelector is returned for unknown selector names, it has no node to offer
+func (d *defaultSelector) Select(ctx context.Context, serviceName string, opts ...Option) (*Node, func(DoneInfo), error) {
+	return nil, nil, ErrNoNodes
 }
 
 func GetSelector(name string) Selector {
+	selectorMu.RLock()
+	defer selectorMu.RUnlock()
 	if selector, ok := selectorMap[name]; ok {
 		return selector
 	}
 	return DefaultSelector
 }
+
+// GetStaticSelector returns the selector balancing over a fixed list of endpoints, it is registered
+// on first use so that all callers of the same endpoints, in any order, share the balancer state.
+// CloseStaticSelector releases it.
+func GetStaticSelector(endpoints ...string) Selector {
+	name := staticSelectorName(endpoints)
+
+	selectorMu.Lock()
+	defer selectorMu.Unlock()
+	if selector, ok := selectorMap[name]; ok {
+		return selector
+	}
+	selector := NewCache(NewStaticResolver(StaticNodes(endpoints...)...))
+	selectorMap[name] = selector
+	return selector
+}
+
+// CloseStaticSelector stops the selector of a list of endpoints and unregisters it,
+// the next GetStaticSelector of the endpoints builds a new one
+func CloseStaticSelector(endpoints ...string) {
+	name := staticSelectorName(endpoints)
+
+	selectorMu.Lock()
+	selector := selectorMap[name]
+	delete(selectorMap, name)
+	selectorMu.Unlock()
+	if c, ok := selector.(*Cache); ok {
+		c.Close()
+	}
+}
+
+// staticSelectorName names the static selector of a list of endpoints whatever their order
+func staticSelectorName(endpoints []string) string {
+	sorted := append([]string(nil), endpoints...)
+	sort.Strings(sorted)
+	return Static + "://" + strings.Join(sorted, ",")
+}
@@ -0,0 +1,147 @@
+package selector
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SlowStartMode is the curve the weight of a new node follows during its slow start window
+type SlowStartMode int
+
+const (
+	Linear      SlowStartMode = iota // the weight grows linearly
+	Exponential                      // the weight doubles at regular intervals
+)
+
+// minimum share of its weight a node gets when it joins
+const slowStartMinFactor = 0.1
+
+// BalancerOptions defines the parameters of the balancers supporting them
+type BalancerOptions struct {
+	SlowStartWindow time.Duration // duration over which the weight of new nodes ramps up, disabled if 0
+	SlowStartMode   SlowStartMode
+}
+
+type BalancerOption func(*BalancerOptions)
+
+// WithSlowStart returns a BalancerOption ramping up the weight of the nodes joining
+// a service over window, nodes resolved along with the service are considered warm.
+// The balancer must be registered to learn about the nodes joining, see SlowStartBalancer.
+func WithSlowStart(window time.Duration, mode SlowStartMode) BalancerOption {
+	return func(o *BalancerOptions) {
+		o.SlowStartWindow = window
+		o.SlowStartMode = mode
+	}
+}
+
+// slowStartBuilders build the balancers supporting slow start
+var slowStartBuilders = map[string]func(...BalancerOption) Balancer{
+	P2C:                NewP2CBalancer,
+	WeightedRoundRobin: NewWeightedRoundRobinBalancer,
+}
+
+// SlowStartBalancer returns the name of a balancer of the given kind, P2C or WeightedRoundRobin,
+// ramping up the weight of the nodes joining a service over window. The balancer is built and
+// registered on first use, registered balancers are told about the nodes joining the services.
+func SlowStartBalancer(kind string, window time.Duration, mode SlowStartMode) (string, error) {
+	build, ok := slowStartBuilders[kind]
+	if !ok {
+		return "", fmt.Errorf("balancer %s does not support slow start", kind)
+	}
+	name := fmt.Sprintf("%s-slowstart-%s-%d", kind, window, mode)
+
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	balancerMu.Lock()
+	balancer, ok := balancerMap[name]
+	if !ok {
+		balancer = build(WithSlowStart(window, mode))
+		balancerMap[name] = balancer
+	}
+	balancerMu.Unlock()
+	// the nodes of the services resolved before are warm, the ones joining from now on are not
+	if !ok {
+		seedBalancer(balancer)
+	}
+	return name, nil
+}
+
+// warmup tracks when the nodes of the services joined, from the updates pushed by the resolver cache
+type warmup struct {
+	window time.Duration
+	mode   SlowStartMode
+
+	mu     sync.RWMutex
+	joined map[string]map[string]time.Time // serviceName -> node id -> time the node joined, zero if warm
+}
+
+func newWarmup(opts *BalancerOptions) *warmup {
+	return &warmup{
+		window: opts.SlowStartWindow,
+		mode:   opts.SlowStartMode,
+		joined: make(map[string]map[string]time.Time),
+	}
+}
+
+func (w *warmup) update(serviceName string, nodes []*Node) {
+	if w.window <= 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	previous, known := w.joined[serviceName]
+	now := time.Now()
+	current := make(map[string]time.Time, len(nodes))
+	for _, node := range nodes {
+		id := node.id()
+		switch t, ok := previous[id]; {
+		case ok:
+			current[id] = t
+		case known:
+			current[id] = now
+		default:
+			// the first nodes of a service are already serving
+			current[id] = time.Time{}
+		}
+	}
+	w.joined[serviceName] = current
+}
+
+// factor returns the share of its weight the node gets, 1 once warm
+func (w *warmup) factor(key string, node *Node) float64 {
+	if w.window <= 0 {
+		return 1
+	}
+
+	w.mu.RLock()
+	joined := w.joined[balancedService(key)][node.id()]
+	w.mu.RUnlock()
+
+	if joined.IsZero() {
+		return 1
+	}
+	progress := float64(time.Since(joined)) / float64(w.window)
+	if progress >= 1 {
+		return 1
+	}
+
+	if w.mode == Exponential {
+		return slowStartMinFactor * math.Pow(1/slowStartMinFactor, progress)
+	}
+	return slowStartMinFactor + (1-slowStartMinFactor)*progress
+}
+
+// balancedService returns the service of a balancing key, balancing keys
+// of subsets of the nodes of a service are suffixed by #subset
+func balancedService(key string) string {
+	if idx := strings.LastIndex(key, "#"); idx != -1 {
+		return key[:idx]
+	}
+	return key
+}
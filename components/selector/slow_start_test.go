@@ -0,0 +1,122 @@
+package selector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWarmupFactor(t *testing.T) {
+	for _, mode := range []SlowStartMode{Linear, Exponential} {
+		w := newWarmup(&BalancerOptions{SlowStartWindow: time.Minute, SlowStartMode: mode})
+		warm := &Node{Address: "127.0.0.1:8000"}
+		cold := &Node{Address: "127.0.0.1:8001"}
+
+		// nodes resolved along with the service are warm
+		w.update("svc", []*Node{warm})
+		w.update("svc", []*Node{warm, cold})
+
+		if f := w.factor("svc", warm); f != 1 {
+			t.Fatalf("mode %d, warm node factor = %f", mode, f)
+		}
+		if f := w.factor("svc#subset", cold); f < slowStartMinFactor || f > 0.2 {
+			t.Fatalf("mode %d, new node factor = %f", mode, f)
+		}
+
+		// half way through the window
+		w.joined["svc"][cold.id()] = time.Now().Add(-30 * time.Second)
+		half := w.factor("svc", cold)
+		if mode == Linear && (half < 0.5 || half > 0.6) {
+			t.Fatalf("linear factor half way = %f", half)
+		}
+		if mode == Exponential && (half < 0.3 || half > 0.35) {
+			t.Fatalf("exponential factor half way = %f", half)
+		}
+
+		w.joined["svc"][cold.id()] = time.Now().Add(-time.Minute)
+		if f := w.factor("svc", cold); f != 1 {
+			t.Fatalf("mode %d, factor after the window = %f", mode, f)
+		}
+	}
+}
+
+func TestWeightedRoundRobinSlowStart(t *testing.T) {
+	b := newWeightedRoundRobinBalancer(WithSlowStart(time.Minute, Linear))
+	nodes := []*Node{{Address: "127.0.0.1:8000"}, {Address: "127.0.0.1:8001"}}
+
+	b.Update("svc", nodes[:1])
+	b.Update("svc", nodes)
+
+	picked := make(map[string]int)
+	for i := 0; i < 110; i++ {
+		picked[b.Balance("svc", nodes).Address]++
+	}
+	if picked["127.0.0.1:8001"] > 15 {
+		t.Fatalf("new node picked %d times out of 110 during slow start", picked["127.0.0.1:8001"])
+	}
+}
+
+func TestSlowStartBalancer(t *testing.T) {
+	name, err := SlowStartBalancer(WeightedRoundRobin, time.Minute, Linear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := SlowStartBalancer(WeightedRoundRobin, time.Minute, Linear); again != name {
+		t.Fatalf("SlowStartBalancer() = %s then %s", name, again)
+	}
+	if _, err := SlowStartBalancer(RoundRobin, time.Minute, Linear); err == nil {
+		t.Fatal("SlowStartBalancer() of round robin succeeded")
+	}
+
+	// the registered balancer learns about the joining nodes from the resolver cache
+	nodes := []*Node{{Address: "127.0.0.1:8000"}, {Address: "127.0.0.1:8001"}}
+	notifyBalancers("slowstart.Service", nodes[:1])
+	notifyBalancers("slowstart.Service", nodes)
+	b := GetBalancer(name).(*weightedRoundRobinBalancer)
+	if f := b.warmup.factor("slowstart.Service", nodes[1]); f >= 0.5 {
+		t.Fatalf("factor of the joining node = %f", f)
+	}
+	if f := b.warmup.factor("slowstart.Service", nodes[0]); f != 1 {
+		t.Fatalf("factor of the warm node = %f", f)
+	}
+}
+
+func TestSlowStartBalancerRegisteredLate(t *testing.T) {
+	nodes := []*Node{{Address: "127.0.0.1:8000"}, {Address: "127.0.0.1:8001"}}
+	notifyBalancers("late.Service", nodes[:1])
+
+	// a node joins between the registration of the balancer and its first pick
+	name, err := SlowStartBalancer(P2C, 3*time.Minute, Linear)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifyBalancers("late.Service", nodes)
+
+	b := GetBalancer(name).(*p2cBalancer)
+	if f := b.warmup.factor("late.Service", nodes[1]); f >= 0.5 {
+		t.Fatalf("factor of the joining node = %f", f)
+	}
+	if f := b.warmup.factor("late.Service", nodes[0]); f != 1 {
+		t.Fatalf("factor of the warm node = %f", f)
+	}
+}
+
+func TestRegisterBalancerConcurrently(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			notifyBalancers("concurrent.Service", []*Node{{Address: "127.0.0.1:8000"}})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		RegisterBalancer(fmt.Sprintf("concurrent-%d", i), NewP2CBalancer())
+	}
+	<-done
+
+	balancerMu.Lock()
+	for i := 0; i < 100; i++ {
+		delete(balancerMap, fmt.Sprintf("concurrent-%d", i))
+	}
+	balancerMu.Unlock()
+}
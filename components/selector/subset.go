@@ -0,0 +1,57 @@
+package selector
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+)
+
+// NewSubsetFilter returns a Filter keeping a deterministic subset of size nodes per client.
+// Nodes are ranked by rendezvous hashing of the client id and the node id : every client
+// gets its own subset, subsets spread evenly over the nodes, and a node joining or leaving
+// the service changes at most one node of each subset.
+func NewSubsetFilter(clientID string, size int) Filter {
+	// scores are computed on every call rather than cached by node id, which would keep the ids
+	// of all the nodes ever seen
+	score := func(node *Node) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(clientID))
+		h.Write([]byte{0})
+		h.Write([]byte(node.id()))
+		return mix(h.Sum64())
+	}
+
+	return func(ctx context.Context, nodes []*Node) []*Node {
+		if size <= 0 || len(nodes) <= size {
+			return nodes
+		}
+
+		ranked := make([]scoredNode, len(nodes))
+		for i, node := range nodes {
+			ranked[i] = scoredNode{node: node, score: score(node)}
+		}
+		sort.Slice(ranked, func(i, j int) bool {
+			return ranked[i].score > ranked[j].score
+		})
+		subset := make([]*Node, size)
+		for i := range subset {
+			subset[i] = ranked[i].node
+		}
+		return subset
+	}
+}
+
+type scoredNode struct {
+	node  *Node
+	score uint64
+}
+
+// mix spreads the bits of a hash, fnv alone ranks ids sharing a prefix too closely
+func mix(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,51 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestSubsetFilter(t *testing.T) {
+	var nodes []*Node
+	for i := 0; i < 100; i++ {
+		nodes = append(nodes, &Node{Address: fmt.Sprintf("10.0.0.%d:8000", i)})
+	}
+
+	// every node ends up in roughly the same number of subsets
+	load := make(map[string]int)
+	for c := 0; c < 1000; c++ {
+		subset := NewSubsetFilter(fmt.Sprintf("client-%d", c), 10)(context.Background(), nodes)
+		if len(subset) != 10 {
+			t.Fatalf("subset size = %d", len(subset))
+		}
+		for _, n := range subset {
+			load[n.Address]++
+		}
+	}
+	for addr, l := range load {
+		if l < 50 || l > 150 {
+			t.Fatalf("node %s is in %d subsets, want about 100", addr, l)
+		}
+	}
+
+	// removing a node of the subset replaces it, the other ones stay
+	filter := NewSubsetFilter("client-0", 10)
+	before := filter(context.Background(), nodes)
+	var remaining []*Node
+	for _, n := range nodes {
+		if n != before[0] {
+			remaining = append(remaining, n)
+		}
+	}
+	after := filter(context.Background(), remaining)
+	kept := make(map[*Node]bool)
+	for _, n := range after {
+		kept[n] = true
+	}
+	for _, n := range before[1:] {
+		if !kept[n] {
+			t.Fatalf("node %s left the subset", n.Address)
+		}
+	}
+}
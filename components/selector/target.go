@@ -0,0 +1,161 @@
+package selector
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const Unix = "unix"
+
+// Target is a client target of the form scheme://authority/endpoint,
+// e.g. consul://127.0.0.1:8500/helloworld.Greeter or static:///127.0.0.1:8000,127.0.0.1:8001
+type Target struct {
+	Scheme    string
+	Authority string
+	Endpoint  string // the path of the target without its leading slash
+}
+
+// Builder builds the selector of the targets of a scheme, along with the network to dial the
+// selected nodes with. An empty network keeps the one configured on the client.
+type Builder func(target Target) (selector Selector, network string, err error)
+
+type builtTarget struct {
+	selector Selector
+	network  string
+}
+
+var (
+	builderMap = make(map[string]Builder)
+	builtMap   = make(map[string]*builtTarget) // target -> selector built for it
+	targetMu   sync.Mutex
+)
+
+func init() {
+	RegisterBuilder(Static, buildStatic)
+	RegisterBuilder(File, buildFile)
+	RegisterBuilder(Unix, buildUnix)
+}
+
+// RegisterBuilder registers the builder of a target scheme
+func RegisterBuilder(scheme string, builder Builder) {
+	targetMu.Lock()
+	defer targetMu.Unlock()
+	builderMap[scheme] = builder
+}
+
+// ParseTarget parses a target, ok is false for targets without scheme such as a plain ip:port
+func ParseTarget(target string) (t Target, ok bool) {
+	idx := strings.Index(target, "://")
+	if idx <= 0 {
+		return Target{}, false
+	}
+	t.Scheme = target[:idx]
+	rest := target[idx+3:]
+	if idx = strings.Index(rest, "/"); idx == -1 {
+		t.Authority = rest
+		return t, true
+	}
+	t.Authority = rest[:idx]
+	t.Endpoint = rest[idx+1:]
+	return t, true
+}
+
+// GetTargetSelector returns the selector and network of a target with a scheme,
+// selectors are built once per target and shared by all its callers
+func GetTargetSelector(target string) (Selector, string, error) {
+	t, ok := ParseTarget(target)
+	if !ok {
+		return nil, "", fmt.Errorf("target %s has no scheme", target)
+	}
+
+	targetMu.Lock()
+	defer targetMu.Unlock()
+
+	if built, ok := builtMap[target]; ok {
+		return built.selector, built.network, nil
+	}
+
+	builder, ok := builderMap[t.Scheme]
+	if !ok {
+		return nil, "", fmt.Errorf("target %s, unknown scheme %s", target, t.Scheme)
+	}
+	selector, network, err := builder(t)
+	if err != nil {
+		return nil, "", err
+	}
+	builtMap[target] = &builtTarget{selector: selector, network: network}
+	return selector, network, nil
+}
+
+// CloseTargetSelector stops the selector built for a target and forgets it,
+// the next GetTargetSelector of the target builds a new one
+func CloseTargetSelector(target string) {
+	targetMu.Lock()
+	built, ok := builtMap[target]
+	delete(builtMap, target)
+	targetMu.Unlock()
+	if !ok {
+		return
+	}
+
+	// static selectors are shared with the callers of their endpoints
+	if t, _ := ParseTarget(target); t.Scheme == Static {
+		CloseStaticSelector(strings.Split(t.Endpoint, ",")...)
+		return
+	}
+	if c, ok := built.selector.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
+
+// buildStatic builds static:///127.0.0.1:8000,127.0.0.1:8001
+func buildStatic(target Target) (Selector, string, error) {
+	if target.Endpoint == "" {
+		return nil, "", fmt.Errorf("static target without endpoints")
+	}
+	return GetStaticSelector(strings.Split(target.Endpoint, ",")...), "", nil
+}
+
+// buildFile builds file:///etc/zrpc/endpoints.json
+func buildFile(target Target) (Selector, string, error) {
+	if target.Endpoint == "" {
+		return nil, "", fmt.Errorf("file target without path")
+	}
+	return NewCache(NewFileResolver("/" + target.Endpoint)), "", nil
+}
+
+// buildUnix builds unix:///run/app.sock
+func buildUnix(target Target) (Selector, string, error) {
+	if target.Endpoint == "" {
+		return nil, "", fmt.Errorf("unix target without socket path")
+	}
+	return GetStaticSelector("/" + target.Endpoint), "unix", nil
+}
+
+// ForService returns a selector resolving serviceName whatever the service of the call,
+// e.g. for targets naming the service they are registered under
+func ForService(selector Selector, serviceName string) Selector {
+	return &serviceSelector{
+		selector:    selector,
+		serviceName: serviceName,
+	}
+}
+
+type serviceSelector struct {
+	selector    Selector
+	serviceName string
+}
+
+func (s *serviceSelector) Select(ctx context.Context, serviceName string, opts ...Option) (*Node, func(DoneInfo), error) {
+	return s.selector.Select(ctx, s.serviceName, opts...)
+}
+
+func (s *serviceSelector) List(ctx context.Context, serviceName string, opts ...Option) ([]*Node, error) {
+	lister, ok := s.selector.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("selector of service %s cannot list its nodes", s.serviceName)
+	}
+	return lister.List(ctx, s.serviceName, opts...)
+}
@@ -0,0 +1,76 @@
+package selector
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		want   Target
+		ok     bool
+	}{
+		{"127.0.0.1:8000", Target{}, false},
+		{"localhost:8000", Target{}, false},
+		{"static:///a:1,b:2", Target{Scheme: "static", Endpoint: "a:1,b:2"}, true},
+		{"consul://127.0.0.1:8500/helloworld.Greeter", Target{Scheme: "consul", Authority: "127.0.0.1:8500", Endpoint: "helloworld.Greeter"}, true},
+		{"unix:///run/app.sock", Target{Scheme: "unix", Endpoint: "run/app.sock"}, true},
+		{"consul://127.0.0.1:8500", Target{Scheme: "consul", Authority: "127.0.0.1:8500"}, true},
+	}
+	for _, tt := range tests {
+		got, ok := ParseTarget(tt.target)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseTarget(%s) = %+v, %v, want %+v, %v", tt.target, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGetTargetSelector(t *testing.T) {
+	s, network, err := GetTargetSelector("static:///127.0.0.1:8000,127.0.0.1:8001")
+	if err != nil || network != "" {
+		t.Fatalf("GetTargetSelector() = %v, %s, %v", s, network, err)
+	}
+	if again, _, _ := GetTargetSelector("static:///127.0.0.1:8000,127.0.0.1:8001"); again != s {
+		t.Fatal("expected the selector of a target to be shared")
+	}
+	node, done, err := s.Select(context.Background(), "helloworld.Greeter", WithBalancerName(RoundRobin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(DoneInfo{})
+	if node.Address != "127.0.0.1:8000" && node.Address != "127.0.0.1:8001" {
+		t.Fatalf("unexpected node %v", node)
+	}
+
+	s, network, err = GetTargetSelector("unix:///run/app.sock")
+	if err != nil || network != "unix" {
+		t.Fatalf("GetTargetSelector(unix) = %s, %v", network, err)
+	}
+	if node, _, _ := s.Select(context.Background(), "helloworld.Greeter"); node.Address != "/run/app.sock" {
+		t.Fatalf("unix node address = %s", node.Address)
+	}
+
+	if _, _, err := GetTargetSelector("unknown:///x"); err == nil {
+		t.Fatal("expected an error for unknown schemes")
+	}
+}
+
+func TestCloseTargetSelector(t *testing.T) {
+	s := GetStaticSelector("127.0.0.1:9001", "127.0.0.1:9000")
+	if again := GetStaticSelector("127.0.0.1:9000", "127.0.0.1:9001"); again != s {
+		t.Fatal("expected the endpoints in any order to share their selector")
+	}
+	if built, _, _ := GetTargetSelector("static:///127.0.0.1:9000,127.0.0.1:9001"); built != s {
+		t.Fatal("expected the static target to share the selector of its endpoints")
+	}
+
+	CloseTargetSelector("static:///127.0.0.1:9000,127.0.0.1:9001")
+	if _, err := s.(*Cache).Nodes(context.Background(), "helloworld.Greeter"); err != ErrCacheClosed {
+		t.Fatalf("Nodes() of a closed selector = %v", err)
+	}
+	if again := GetStaticSelector("127.0.0.1:9000", "127.0.0.1:9001"); again == s {
+		t.Fatal("expected a new selector once closed")
+	}
+	CloseStaticSelector("127.0.0.1:9000", "127.0.0.1:9001")
+}
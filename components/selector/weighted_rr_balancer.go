@@ -5,15 +5,29 @@ import (
 	"time"
 )
 
+// weights are scaled so that slow start keeps some precision on small weights
+const weightScale = 100
+
 type weightedRoundRobinBalancer struct {
 	pickers  *sync.Map
 	duration time.Duration
+	warmup   *warmup
+}
+
+// NewWeightedRoundRobinBalancer returns a smooth weighted round robin balancer
+func NewWeightedRoundRobinBalancer(opts ...BalancerOption) Balancer {
+	return newWeightedRoundRobinBalancer(opts...)
 }
 
-func newWeightedRoundRobinBalancer() *weightedRoundRobinBalancer {
+func newWeightedRoundRobinBalancer(opts ...BalancerOption) *weightedRoundRobinBalancer {
+	o := &BalancerOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	return &weightedRoundRobinBalancer{
 		pickers:  new(sync.Map),
 		duration: 3 * time.Minute,
+		warmup:   newWarmup(o),
 	}
 }
 
@@ -25,38 +39,44 @@ type weightedNode struct {
 }
 
 type wRoundRobinPicker struct {
+	mu             sync.Mutex
 	nodes          []*weightedNode
 	lastUpdateTime time.Time
 	duration       time.Duration
 }
 
-func (wr *wRoundRobinPicker) pick(nodes []*Node) *Node {
+func (wr *wRoundRobinPicker) pick(key string, nodes []*Node, w *warmup) *Node {
 	if len(nodes) == 0 {
 		return nil
 	}
 
-	// update picker after timeout
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	// update picker after timeout or once the nodes or their weights changed in the registry
 	if time.Now().Sub(wr.lastUpdateTime) > wr.duration ||
-		len(nodes) != len(wr.nodes) {
+		!sameWeightedNodes(wr.nodes, nodes) {
 		wr.nodes = getWeightedNode(nodes)
 		wr.lastUpdateTime = time.Now()
 	}
 
 	totalWeight := 0
-	maxWeight := 0
-	index := 0
+	index := -1
 	for i, node := range wr.nodes {
-		node.currentWeight += node.weight
-		totalWeight += node.weight
-		if node.currentWeight > maxWeight {
-			maxWeight = node.currentWeight
+		node.effectiveWeight = int(float64(node.weight*weightScale) * w.factor(key, nodes[i]))
+		if node.effectiveWeight < 1 {
+			node.effectiveWeight = 1
+		}
+		node.currentWeight += node.effectiveWeight
+		totalWeight += node.effectiveWeight
+		if index == -1 || node.currentWeight > wr.nodes[index].currentWeight {
 			index = i
 		}
 	}
 
 	wr.nodes[index].currentWeight -= totalWeight
 
-	return wr.nodes[index].node
+	return nodes[index]
 
 }
 
@@ -66,17 +86,16 @@ func (w *weightedRoundRobinBalancer) Balance(serviceName string, nodes []*Node)
 		return nil
 	}
 	if p, ok := w.pickers.Load(serviceName); !ok {
-		picker = &wRoundRobinPicker{
+		p, _ = w.pickers.LoadOrStore(serviceName, &wRoundRobinPicker{
 			nodes:          getWeightedNode(nodes),
-			lastUpdateTime: time.Time{},
-			duration:       0,
-		}
+			lastUpdateTime: time.Now(),
+			duration:       w.duration,
+		})
+		picker = p.(*wRoundRobinPicker)
 	} else {
 		picker = p.(*wRoundRobinPicker)
 	}
-	node := picker.pick(nodes)
-	w.pickers.Store(serviceName, picker)
-	return node
+	return picker.pick(serviceName, nodes, w.warmup)
 }
 
 func getWeightedNode(nodes []*Node) []*weightedNode {
@@ -84,10 +103,28 @@ func getWeightedNode(nodes []*Node) []*weightedNode {
 	for _, node := range nodes {
 		wgs = append(wgs, &weightedNode{
 			node:            node,
-			weight:          node.weight,
-			currentWeight:   node.weight,
-			effectiveWeight: node.weight,
+			weight:          node.GetWeight(),
+			effectiveWeight: node.GetWeight() * weightScale,
 		})
 	}
 	return wgs
 }
+
+// sameWeightedNodes reports whether the picker state still matches the resolved nodes
+func sameWeightedNodes(wgs []*weightedNode, nodes []*Node) bool {
+	if len(wgs) != len(nodes) {
+		return false
+	}
+	for i, node := range nodes {
+		if wgs[i].node.id() != node.id() || wgs[i].weight != node.GetWeight() {
+			return false
+		}
+	}
+	return true
+}
+
+// Update resets the pickers of a service whose nodes changed, and of its subsets
+func (w *weightedRoundRobinBalancer) Update(serviceName string, nodes []*Node) {
+	w.warmup.update(serviceName, nodes)
+	deleteServiceKeys(w.pickers, serviceName)
+}
@@ -0,0 +1,62 @@
+package selector
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestWeightedRoundRobinBalancer(t *testing.T) {
+	b := newWeightedRoundRobinBalancer()
+	nodes := []*Node{
+		{Address: "127.0.0.1:8000", Weight: 3},
+		{Address: "127.0.0.1:8001", Weight: 1},
+	}
+
+	picked := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		picked[b.Balance("svc", nodes).Address]++
+	}
+	if picked["127.0.0.1:8000"] != 6 || picked["127.0.0.1:8001"] != 2 {
+		t.Fatalf("unexpected distribution %v", picked)
+	}
+
+	// the operator changes the weights in the registry
+	nodes = []*Node{
+		{Address: "127.0.0.1:8000", Weight: 1},
+		{Address: "127.0.0.1:8001", Weight: 1},
+	}
+	picked = make(map[string]int)
+	for i := 0; i < 8; i++ {
+		picked[b.Balance("svc", nodes).Address]++
+	}
+	if picked["127.0.0.1:8000"] != 4 || picked["127.0.0.1:8001"] != 4 {
+		t.Fatalf("unexpected distribution after weight change %v", picked)
+	}
+}
+
+func TestUpdateDropsSubsetPickers(t *testing.T) {
+	nodes := []*Node{{Address: "127.0.0.1:8000"}, {Address: "127.0.0.1:8001"}, {Address: "127.0.0.1:8002"}}
+	count := func(pickers *sync.Map) int {
+		n := 0
+		pickers.Range(func(_, _ interface{}) bool {
+			n++
+			return true
+		})
+		return n
+	}
+
+	wrr, rr := newWeightedRoundRobinBalancer(), newRoundRobinBalancer()
+	for _, b := range []Balancer{wrr, rr} {
+		b.Balance("svc", nodes)
+		b.Balance(subsetKey("svc", nodes[:1]), nodes[:1])
+		b.Balance(subsetKey("svc", nodes[1:]), nodes[1:])
+		b.Balance("svc2", nodes)
+		b.(Updater).Update("svc", nodes[1:])
+	}
+	if n := count(wrr.pickers); n != 1 {
+		t.Errorf("weighted round robin pickers after Update = %d, want 1", n)
+	}
+	if n := count(rr.pickers); n != 1 {
+		t.Errorf("round robin pickers after Update = %d, want 1", n)
+	}
+}
@@ -0,0 +1,52 @@
+package selector
+
+import (
+	"context"
+	"sort"
+)
+
+// NewZoneFilter returns a Filter preferring the nodes of the local zone. When fewer than
+// minHealthy nodes are left in the local zone, the nodes of the failover zones are added in
+// order, then the ones of all other zones, until at least minHealthy nodes can be picked from.
+func NewZoneFilter(zone string, minHealthy int, failover ...string) Filter {
+	if minHealthy < 1 {
+		minHealthy = 1
+	}
+	return func(ctx context.Context, nodes []*Node) []*Node {
+		if zone == "" {
+			return nodes
+		}
+
+		byZone := make(map[string][]*Node)
+		for _, node := range nodes {
+			byZone[node.Zone] = append(byZone[node.Zone], node)
+		}
+
+		selected := byZone[zone]
+		if len(selected) >= minHealthy {
+			return selected
+		}
+		visited := map[string]bool{zone: true}
+
+		// failover zones first, in priority order, then the remaining ones in a stable order
+		order := append([]string{}, failover...)
+		var others []string
+		for z := range byZone {
+			others = append(others, z)
+		}
+		sort.Strings(others)
+		order = append(order, others...)
+
+		for _, z := range order {
+			if visited[z] {
+				continue
+			}
+			visited[z] = true
+			selected = append(selected, byZone[z]...)
+			if len(selected) >= minHealthy {
+				break
+			}
+		}
+		return selected
+	}
+}
@@ -0,0 +1,40 @@
+package selector
+
+import (
+	"context"
+	"testing"
+)
+
+func TestZoneFilter(t *testing.T) {
+	nodes := []*Node{
+		{Address: "10.0.1.1:8000", Zone: "az1"},
+		{Address: "10.0.1.2:8000", Zone: "az1"},
+		{Address: "10.0.2.1:8000", Zone: "az2"},
+		{Address: "10.0.3.1:8000", Zone: "az3"},
+	}
+
+	zones := func(nodes []*Node) map[string]int {
+		m := make(map[string]int)
+		for _, n := range nodes {
+			m[n.Zone]++
+		}
+		return m
+	}
+
+	got := zones(NewZoneFilter("az1", 2)(context.Background(), nodes))
+	if len(got) != 1 || got["az1"] != 2 {
+		t.Fatalf("local zone healthy, got %v", got)
+	}
+
+	// az1 lost a node, spill over to az3 first
+	got = zones(NewZoneFilter("az1", 2, "az3", "az2")(context.Background(), nodes[1:]))
+	if len(got) != 2 || got["az1"] != 1 || got["az3"] != 1 {
+		t.Fatalf("spill over to az3, got %v", got)
+	}
+
+	// no node in the local zone, all zones are needed
+	got = zones(NewZoneFilter("az4", 3, "az2")(context.Background(), nodes))
+	if got["az2"] != 1 || got["az1"] != 2 || got["az3"] != 0 {
+		t.Fatalf("spill over from az4, got %v", got)
+	}
+}
@@ -9,6 +9,14 @@ const (
 	InternalError  = 3
 )
 
+// codes of the framework errors, they differ from InternalError, the code of the other errors
+const (
+	InvalidArgument  = 4  // the request cannot be decoded
+	NotFound         = 5  // the service or the method does not exist
+	PermissionDenied = 7  // the caller may not call the method
+	Unauthenticated  = 16 // the call carries no valid credentials
+)
+
 const (
 	SUCCESS              = "success"
 	InternalErrorMessage = "server internal error"
@@ -0,0 +1,236 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/log"
+)
+
+const defaultReloadInterval = 10 * time.Second
+
+// Options defines where the certificates are loaded from
+type Options struct {
+	CertFile       string        // pem certificate presented to the peer
+	KeyFile        string        // pem private key of the certificate
+	CAFile         string        // pem CAs verifying the peer, servers require client certificates once set
+	ServerName     string        // name verified in the server certificate, the host dialed if empty
+	MinVersion     uint16        // minimum tls version, tls 1.2 by default
+	ReloadInterval time.Duration // interval at which the files are checked for changes
+}
+
+type Option func(*Options)
+
+// WithCertificate returns an Option which sets the certificate presented to the peer
+func WithCertificate(certFile, keyFile string) Option {
+	return func(o *Options) {
+		o.CertFile = certFile
+		o.KeyFile = keyFile
+	}
+}
+
+// WithCA returns an Option which sets the CAs verifying the certificate of the peer
+func WithCA(caFile string) Option {
+	return func(o *Options) {
+		o.CAFile = caFile
+	}
+}
+
+// WithServerName returns an Option which sets the name verified in the server certificate
+func WithServerName(serverName string) Option {
+	return func(o *Options) {
+		o.ServerName = serverName
+	}
+}
+
+// WithMinVersion returns an Option which sets the minimum tls version, e.g. tls.VersionTLS13
+func WithMinVersion(version uint16) Option {
+	return func(o *Options) {
+		o.MinVersion = version
+	}
+}
+
+// WithReloadInterval returns an Option which sets how often the files are checked for changes
+func WithReloadInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.ReloadInterval = interval
+	}
+}
+
+// NewServerConfig returns the tls config of a server. The certificate and the client CAs are
+// reloaded once their files change, new connections use them without restarting the server.
+// Client certificates are required and verified once a CA is set.
+func NewServerConfig(opts ...Option) (*tls.Config, error) {
+	s, err := newStore(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.CertFile == "" {
+		return nil, errors.New("tls server without certificate")
+	}
+
+	return &tls.Config{
+		MinVersion: s.opts.MinVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := s.get()
+			cfg := &tls.Config{
+				MinVersion:   s.opts.MinVersion,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if pool != nil {
+				cfg.ClientCAs = pool
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}, nil
+}
+
+// NewClientConfig returns the tls config of a client. The client certificate and the CAs are
+// reloaded once their files change. The server is verified with the CAs, or the system ones,
+// zRPC clients verify the host they dial when the config has no server name, ip addresses included.
+func NewClientConfig(opts ...Option) (*tls.Config, error) {
+	s, err := newStore(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion: s.opts.MinVersion,
+		ServerName: s.opts.ServerName,
+	}
+	if s.opts.CAFile != "" {
+		// RootCAs are read once, the server is verified with the current CAs instead
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			_, pool := s.get()
+			return verifyServer(cs, pool)
+		}
+	}
+	if s.opts.CertFile != "" {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := s.get()
+			return cert, nil
+		}
+	}
+	return cfg, nil
+}
+
+// verifyServer verifies the certificate chain of a server and its name with the CAs of roots
+func verifyServer(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls server without certificate")
+	}
+	if cs.ServerName == "" {
+		return errors.New("tls server name to verify not set")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// store keeps the certificates loaded from the files, reloading them once they change
+type store struct {
+	opts *Options
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	stamp   string    // modification times of the files loaded
+	checked time.Time // last time the files were checked for changes
+}
+
+func newStore(opts ...Option) (*store, error) {
+	o := &Options{
+		MinVersion:     tls.VersionTLS12,
+		ReloadInterval: defaultReloadInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	s := &store{opts: o}
+	stamp, err := s.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.load(stamp); err != nil {
+		return nil, err
+	}
+	s.checked = time.Now()
+	return s, nil
+}
+
+// get returns the current certificate and CAs, reloading them if the files changed.
+// The previous ones are kept if the new files cannot be loaded, e.g. while being written.
+func (s *store) get() (*tls.Certificate, *x509.CertPool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checked) >= s.opts.ReloadInterval {
+		s.checked = time.Now()
+		stamp, err := s.stat()
+		if err != nil {
+			log.Errorf("tls files check error, %v", err)
+		} else if stamp != s.stamp {
+			if err := s.load(stamp); err != nil {
+				log.Errorf("tls files reload error, %v", err)
+			}
+		}
+	}
+	return s.cert, s.pool
+}
+
+func (s *store) stat() (string, error) {
+	var stamp string
+	for _, file := range []string{s.opts.CertFile, s.opts.KeyFile, s.opts.CAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d-%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
+
+func (s *store) load(stamp string) error {
+	var cert *tls.Certificate
+	if s.opts.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(s.opts.CertFile, s.opts.KeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if s.opts.CAFile != "" {
+		pem, err := ioutil.ReadFile(s.opts.CAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", s.opts.CAFile)
+		}
+	}
+
+	s.cert, s.pool, s.stamp = cert, pool, stamp
+	return nil
+}
@@ -0,0 +1,151 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for name and its key to dir
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if err := ioutil.WriteFile(certFile, certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func leafName(t *testing.T, cfg *tls.Config) string {
+	serverCfg, err := cfg.GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(serverCfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestServerConfigReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "first")
+	cfg, err := NewServerConfig(WithCertificate(certFile, keyFile), WithCA(certFile), WithReloadInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := leafName(t, cfg); name != "first" {
+		t.Fatalf("certificate of %s", name)
+	}
+
+	serverCfg, _ := cfg.GetConfigForClient(&tls.ClientHelloInfo{})
+	if serverCfg.ClientAuth != tls.RequireAndVerifyClientCert || serverCfg.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("client auth %v, min version %x", serverCfg.ClientAuth, serverCfg.MinVersion)
+	}
+
+	// rotated certificates are picked up by the next connections
+	time.Sleep(10 * time.Millisecond)
+	writeCert(t, dir, "second")
+	if name := leafName(t, cfg); name != "second" {
+		t.Fatalf("certificate of %s after rotation", name)
+	}
+
+	// a broken file keeps the previous certificate
+	time.Sleep(10 * time.Millisecond)
+	if err := ioutil.WriteFile(certFile, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if name := leafName(t, cfg); name != "second" {
+		t.Fatalf("certificate of %s after a broken rotation", name)
+	}
+}
+
+func readCert(t *testing.T, certFile string) *x509.Certificate {
+	certPem, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPem)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestClientConfigReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tlsconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	caFile, _ := writeCert(t, dir, "first")
+	first := readCert(t, caFile)
+	cfg, err := NewClientConfig(WithCA(caFile), WithReloadInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := tls.ConnectionState{ServerName: "first", PeerCertificates: []*x509.Certificate{first}}
+	if err := cfg.VerifyConnection(state); err != nil {
+		t.Fatalf("verify first = %v", err)
+	}
+	if err := cfg.VerifyConnection(tls.ConnectionState{ServerName: "other", PeerCertificates: state.PeerCertificates}); err == nil {
+		t.Fatal("verify first for another name succeeded")
+	}
+
+	// rotated CAs verify the next connections
+	time.Sleep(10 * time.Millisecond)
+	writeCert(t, dir, "second")
+	second := readCert(t, caFile)
+	if err := cfg.VerifyConnection(state); err == nil {
+		t.Fatal("verify first after rotation succeeded")
+	}
+	if err := cfg.VerifyConnection(tls.ConnectionState{ServerName: "second", PeerCertificates: []*x509.Certificate{second}}); err != nil {
+		t.Fatalf("verify second = %v", err)
+	}
+}
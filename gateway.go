@@ -0,0 +1,162 @@
+package zRPC
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/codec"
+	"github.com/WeilunZ/zRPC/components/log"
+	"github.com/WeilunZ/zRPC/components/metadata"
+	"github.com/WeilunZ/zRPC/components/peer"
+	"github.com/WeilunZ/zRPC/components/protocol"
+	"github.com/WeilunZ/zRPC/components/state"
+	"github.com/WeilunZ/zRPC/transport"
+)
+
+// JSONRPCPath is the path of the gateway serving json-rpc 2.0 requests
+const JSONRPCPath = "/jsonrpc"
+
+// gatewayReadHeaderTimeout bounds the time a client takes to send the headers of a request
+const gatewayReadHeaderTimeout = 10 * time.Second
+
+// gatewayError is the body of the failed gateway calls
+type gatewayError struct {
+	Code    uint32 `json:"code"`
+	Type    int    `json:"type,omitempty"`
+	Message string `json:"message"`
+}
+
+// serveHTTP starts the http/json gateway, it is closed with the server
+func (s *Server) serveHTTP() error {
+	lis, err := net.Listen("tcp", s.opts.HTTPAddress)
+	if err != nil {
+		return err
+	}
+	s.httpServer = &http.Server{Handler: s, TLSConfig: s.opts.TLSConfig, ReadHeaderTimeout: gatewayReadHeaderTimeout}
+
+	go func() {
+		var err error
+		if s.opts.TLSConfig != nil {
+			err = s.httpServer.ServeTLS(lis, "", "")
+		} else {
+			err = s.httpServer.Serve(lis)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("http gateway serve error, %v", err)
+		}
+	}()
+	return nil
+}
+
+// ServeHTTP serves POST /{service}/{method} with a json body decoded into the request of the method,
+// the response is returned as json. Failed calls return a json {"code", "message"} body with the
+// http status of their error. POST /jsonrpc serves json-rpc 2.0 requests and batches.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHTTPError(w, http.StatusMethodNotAllowed, state.NewFrameworkError(state.InvalidArgument, "only POST is supported"))
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, transport.MaxPayLoadLength))
+	if err != nil {
+		writeHTTPError(w, http.StatusRequestEntityTooLarge, state.NewFrameworkError(state.InvalidArgument, err.Error()))
+		return
+	}
+
+	md := metadata.MD{}
+	for _, header := range s.opts.HTTPHeaders {
+		if v := r.Header.Get(header); v != "" {
+			md[strings.ToLower(header)] = v
+		}
+	}
+
+	// connections served by the server transport carry their peer already
+	ctx := r.Context()
+	if _, ok := peer.FromContext(ctx); !ok {
+		ctx = peer.NewContext(ctx, httpPeer(r))
+	}
+
+	// json-rpc errors are returned in the response body
+	if r.URL.Path == JSONRPCPath {
+		rsp := transport.HandleJSONRPC(ctx, s, payload, md.ToHeader())
+		if rsp == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(rsp)
+		return
+	}
+
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+	if !json.Valid(payload) {
+		writeHTTPError(w, http.StatusBadRequest, state.NewFrameworkError(state.InvalidArgument, "invalid json body"))
+		return
+	}
+	request := &protocol.Request{
+		ServicePath: r.URL.Path,
+		Payload:     payload,
+		Metadata:    md.ToHeader(),
+	}
+
+	rsp, err := s.HandleRequest(ctx, request, codec.Json)
+	if err != nil {
+		writeHTTPError(w, httpStatus(err), err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(rsp)
+}
+
+// httpPeer returns the peer of an http request
+func httpPeer(r *http.Request) *peer.Peer {
+	p := &peer.Peer{TLS: r.TLS}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		p.Addr = addr
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		p.Identity = peer.Identity(r.TLS.VerifiedChains[0][0])
+	}
+	return p
+}
+
+// httpStatus returns the http status of the error of a call
+func httpStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	e, ok := err.(*state.Error)
+	if !ok || e.Type != state.FrameworkError {
+		return http.StatusInternalServerError
+	}
+	switch e.Code {
+	case state.InvalidArgument:
+		return http.StatusBadRequest
+	case state.NotFound:
+		return http.StatusNotFound
+	case state.PermissionDenied:
+		return http.StatusForbidden
+	case state.Unauthenticated:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	body := &gatewayError{Code: state.InternalError, Message: err.Error()}
+	if e, ok := err.(*state.Error); ok {
+		body = &gatewayError{Code: e.Code, Type: e.Type, Message: e.Message}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
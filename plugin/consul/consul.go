@@ -1,10 +1,15 @@
 package consul
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net/http"
-	"strings"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/log"
 
 	"github.com/WeilunZ/zRPC/components/selector"
 	"github.com/WeilunZ/zRPC/plugin"
@@ -14,23 +19,71 @@ import (
 // Consul implements the server discovery specification
 type Consul struct {
 	opts         *plugin.Options
+	consulOpts   *Options
 	client       *api.Client
 	config       *api.Config
-	balancerName string // load balancing mode, including random, polling, weighted polling, consistent hash, etc
 	writeOptions *api.WriteOptions
 	queryOptions *api.QueryOptions
+	cache        *selector.Cache // nodes of the selected services, kept up to date by blocking queries
+
+	mu         sync.Mutex
+	heartbeats map[string]context.CancelFunc // service id -> stops the ttl heartbeat
 }
 
 const Name = "consul"
 
+// maximum time a blocking query waits for a change
+const watchWaitTime = 5 * time.Minute
+
+// metadata keys published along with the tags
+const (
+	metaWeight    = "weight"
+	metaVersion   = "version"
+	metaZone      = "zone"
+	metaNamespace = "namespace"
+)
+
 func init() {
 	plugin.Register(Name, ConsulSvr)
 	selector.RegisterSelector(Name, ConsulSvr)
+	selector.RegisterBuilder(Name, buildTarget)
 }
 
 // global consul objects for framework
 var ConsulSvr = &Consul{
-	opts: &plugin.Options{},
+	opts:       &plugin.Options{},
+	consulOpts: defaultOptions(),
+	heartbeats: make(map[string]context.CancelFunc),
+}
+
+// buildTarget builds consul://127.0.0.1:8500/helloworld.Greeter targets, the agent address
+// defaults to the one of the global consul object and the service to the one of the call
+func buildTarget(target selector.Target) (selector.Selector, string, error) {
+	var s selector.Selector = ConsulSvr
+	if target.Authority != "" {
+		consulOpts := *ConsulSvr.consulOpts
+		c := &Consul{
+			opts:       &plugin.Options{SelectorSvrAddr: target.Authority},
+			consulOpts: &consulOpts,
+			heartbeats: make(map[string]context.CancelFunc),
+		}
+		if err := c.InitConfig(); err != nil {
+			return nil, "", err
+		}
+		s = c
+	}
+
+	if target.Endpoint != "" {
+		s = selector.ForService(s, target.Endpoint)
+	}
+	return s, "", nil
+}
+
+// Configure sets the consul specific settings, it must be called before Init
+func (c *Consul) Configure(opts ...Option) {
+	for _, o := range opts {
+		o(c.consulOpts)
+	}
 }
 
 func (c *Consul) InitConfig() error {
@@ -38,9 +91,14 @@ func (c *Consul) InitConfig() error {
 	config := api.DefaultConfig()
 	c.config = config
 
-	config.HttpClient = http.DefaultClient
 	config.Address = c.opts.SelectorSvrAddr
 	config.Scheme = "http"
+	config.Token = c.consulOpts.Token
+	config.Datacenter = c.consulOpts.Datacenter
+	if c.consulOpts.tlsEnabled() {
+		config.Scheme = "https"
+		config.TLSConfig = c.consulOpts.TLSConfig
+	}
 
 	client, err := api.NewClient(config)
 	if err != nil {
@@ -48,57 +106,114 @@ func (c *Consul) InitConfig() error {
 	}
 
 	c.client = client
+	if c.cache != nil {
+		c.cache.Close()
+	}
+	c.cache = selector.NewCache(c)
 
 	return nil
 }
 
 func (c *Consul) Resolve(serviceName string) ([]*selector.Node, error) {
 
-	pairs, _, err := c.client.KV().List(serviceName, nil)
+	namespace, name := selector.SplitServiceKey(serviceName)
+	entries, _, err := c.client.Health().Service(name, "", true, c.queryOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(pairs) == 0 {
+	nodes := parseNodes(namespace, entries)
+	if len(nodes) == 0 {
 		return nil, fmt.Errorf("no services find in path : %s", serviceName)
 	}
-	var nodes []*selector.Node
-	for _, pair := range pairs {
-		nodes = append(nodes, &selector.Node{
-			Key:   pair.Key,
-			Value: pair.Value,
-		})
-	}
 	return nodes, nil
 }
 
-// implements selector Select method
-func (c *Consul) Select(serviceName string) (string, error) {
+// Watch implements selector.Watcher with a blocking query on the passing instances of the service
+func (c *Consul) Watch(ctx context.Context, serviceName string, lastIndex uint64) ([]*selector.Node, uint64, error) {
+	q := &api.QueryOptions{}
+	if c.queryOptions != nil {
+		*q = *c.queryOptions
+	}
+	q.WaitIndex = lastIndex
+	q.WaitTime = watchWaitTime
+
+	namespace, name := selector.SplitServiceKey(serviceName)
+	entries, meta, err := c.client.Health().Service(name, "", true, q.WithContext(ctx))
+	if err != nil {
+		return nil, lastIndex, err
+	}
+
+	// the index went backwards, e.g. after a consul snapshot restore, start over
+	index := meta.LastIndex
+	if index < lastIndex {
+		index = 0
+	}
 
-	nodes, err := c.Resolve(serviceName)
+	return parseNodes(namespace, entries), index, nil
+}
 
-	if nodes == nil || len(nodes) == 0 || err != nil {
-		return "", err
+// parseNodes converts the entries registered in the namespace, entries of other namespaces are dropped
+func parseNodes(namespace string, entries []*api.ServiceEntry) []*selector.Node {
+	var nodes []*selector.Node
+	for _, entry := range entries {
+		if entry.Service.Meta[metaNamespace] != namespace {
+			continue
+		}
+		nodes = append(nodes, parseNode(entry))
 	}
+	return nodes
+}
 
-	balancer := selector.GetBalancer(c.balancerName)
-	node := balancer.Balance(serviceName, nodes)
+// parseNode converts a catalog entry back to the node published by Register
+func parseNode(entry *api.ServiceEntry) *selector.Node {
+	host := entry.Service.Address
+	if host == "" {
+		host = entry.Node.Address
+	}
 
-	if node == nil {
-		return "", fmt.Errorf("no services find in %s", serviceName)
+	node := &selector.Node{
+		Key:     entry.Service.ID,
+		Address: net.JoinHostPort(host, strconv.Itoa(entry.Service.Port)),
 	}
 
-	return parseAddrFromNode(node)
+	for k, v := range entry.Service.Meta {
+		switch k {
+		case metaWeight:
+			node.Weight, _ = strconv.Atoi(v)
+		case metaVersion:
+			node.Version = v
+		case metaZone:
+			node.Zone = v
+		case metaNamespace:
+		default:
+			if node.Tags == nil {
+				node.Tags = make(map[string]string)
+			}
+			node.Tags[k] = v
+		}
+	}
+	return node
 }
 
-func parseAddrFromNode(node *selector.Node) (string, error) {
-	if node.Key == "" {
-		return "", errors.New("addr is empty")
+// implements selector Select method
+func (c *Consul) Select(ctx context.Context, serviceName string, opts ...selector.Option) (*selector.Node, func(selector.DoneInfo), error) {
+
+	if c.cache == nil {
+		return nil, nil, errors.New("consul selector is not initialized")
 	}
 
-	strs := strings.Split(node.Key, "/")
+	return c.cache.Select(ctx, serviceName, opts...)
+}
+
+// implements selector List method
+func (c *Consul) List(ctx context.Context, serviceName string, opts ...selector.Option) ([]*selector.Node, error) {
+
+	if c.cache == nil {
+		return nil, errors.New("consul selector is not initialized")
+	}
 
-	return strs[len(strs)-1], nil
+	return c.cache.List(ctx, serviceName, opts...)
 }
 
 func (c *Consul) Init(opts ...plugin.Option) error {
@@ -116,23 +231,162 @@ func (c *Consul) Init(opts ...plugin.Option) error {
 		return err
 	}
 
-	for _, serviceName := range c.opts.Services {
-		nodeName := fmt.Sprintf("%s/%s", serviceName, c.opts.SvrAddr)
+	return nil
+}
 
-		kvPair := &api.KVPair{
-			Key:   nodeName,
-			Value: []byte(c.opts.SvrAddr),
-			Flags: api.LockFlagValue,
-		}
+// Register implements registry.Registry, the node is registered to the consul agent
+// along with a tcp or ttl health check
+func (c *Consul) Register(ctx context.Context, serviceName string, node *selector.Node) error {
+	if err := c.consulOpts.validate(); err != nil {
+		return err
+	}
+	if err := validateTags(node.Tags); err != nil {
+		return err
+	}
+	if c.client == nil {
+		return errors.New("consul registry is not initialized")
+	}
 
-		if _, err := c.client.KV().Put(kvPair, c.writeOptions); err != nil {
-			return err
-		}
+	host, portStr, err := net.SplitHostPort(node.Address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid port in address %s", node.Address)
+	}
+
+	namespace, name := selector.SplitServiceKey(serviceName)
+	meta := nodeMeta(node)
+	if namespace != "" {
+		meta[metaNamespace] = namespace
+	}
+
+	id := serviceID(serviceName, node)
+	registration := &api.AgentServiceRegistration{
+		ID:      id,
+		Name:    name,
+		Address: host,
+		Port:    port,
+		Meta:    meta,
+		Weights: &api.AgentWeights{Passing: node.GetWeight(), Warning: 1},
+		Check:   c.check(id, node),
+	}
+
+	if err := c.client.Agent().ServiceRegister(registration); err != nil {
+		return err
 	}
 
+	if c.consulOpts.CheckType == TTLCheck {
+		c.startHeartbeat(id)
+	}
+	return nil
+}
+
+// Deregister implements registry.Registry
+func (c *Consul) Deregister(ctx context.Context, serviceName string, node *selector.Node) error {
+	if c.client == nil {
+		return errors.New("consul registry is not initialized")
+	}
+
+	id := serviceID(serviceName, node)
+	c.stopHeartbeat(id)
+	return c.client.Agent().ServiceDeregister(id)
+}
+
+// serviceID identifies the instance in consul, e.g. staging-helloworld.Greeter-127.0.0.1:8000
+func serviceID(serviceName string, node *selector.Node) string {
+	namespace, name := selector.SplitServiceKey(serviceName)
+	if namespace == "" {
+		return fmt.Sprintf("%s-%s", name, node.Address)
+	}
+	return fmt.Sprintf("%s-%s-%s", namespace, name, node.Address)
+}
+
+func checkID(serviceID string) string {
+	return "service:" + serviceID
+}
+
+// validateTags rejects the tags named after the metadata keys, which would overwrite them
+func validateTags(tags map[string]string) error {
+	for _, key := range []string{metaWeight, metaVersion, metaZone, metaNamespace} {
+		if _, ok := tags[key]; ok {
+			return fmt.Errorf("invalid tag %s, the name is reserved", key)
+		}
+	}
 	return nil
 }
 
+func nodeMeta(node *selector.Node) map[string]string {
+	meta := make(map[string]string, len(node.Tags)+3)
+	for k, v := range node.Tags {
+		meta[k] = v
+	}
+	meta[metaWeight] = strconv.Itoa(node.GetWeight())
+	if node.Version != "" {
+		meta[metaVersion] = node.Version
+	}
+	if node.Zone != "" {
+		meta[metaZone] = node.Zone
+	}
+	return meta
+}
+
+func (c *Consul) check(id string, node *selector.Node) *api.AgentServiceCheck {
+	check := &api.AgentServiceCheck{
+		CheckID:                        checkID(id),
+		DeregisterCriticalServiceAfter: c.consulOpts.DeregisterCriticalAfter.String(),
+	}
+	if c.consulOpts.CheckType == TTLCheck {
+		check.TTL = c.consulOpts.CheckTTL.String()
+		return check
+	}
+	check.TCP = node.Address
+	check.Interval = c.consulOpts.CheckInterval.String()
+	check.Timeout = c.consulOpts.CheckTimeout.String()
+	return check
+}
+
+// startHeartbeat passes the ttl check of the service until it is deregistered
+func (c *Consul) startHeartbeat(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.heartbeats[id]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.heartbeats[id] = cancel
+
+	go func() {
+		interval := c.consulOpts.CheckTTL / 3
+		if err := c.client.Agent().UpdateTTL(checkID(id), "", api.HealthPassing); err != nil {
+			log.Errorf("consul pass ttl of %s error, %v", id, err)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := c.client.Agent().UpdateTTL(checkID(id), "", api.HealthPassing); err != nil {
+					log.Errorf("consul pass ttl of %s error, %v", id, err)
+				}
+			}
+		}
+	}()
+}
+
+func (c *Consul) stopHeartbeat(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cancel, ok := c.heartbeats[id]; ok {
+		cancel()
+		delete(c.heartbeats, id)
+	}
+}
+
 // Init implements the initialization of the consul configuration when the framework is loaded
 func Init(consulSvrAddr string, opts ...plugin.Option) error {
 	for _, o := range opts {
@@ -143,3 +397,8 @@ func Init(consulSvrAddr string, opts ...plugin.Option) error {
 	err := ConsulSvr.InitConfig()
 	return err
 }
+
+// Configure sets the consul specific settings of the global consul object
+func Configure(opts ...Option) {
+	ConsulSvr.Configure(opts...)
+}
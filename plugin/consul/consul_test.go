@@ -0,0 +1,64 @@
+package consul
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/selector"
+	"github.com/hashicorp/consul/api"
+)
+
+func TestNodeMetaRoundTrip(t *testing.T) {
+	node := &selector.Node{
+		Address: "127.0.0.1:8000",
+		Weight:  20,
+		Version: "v2",
+		Zone:    "az1",
+		Tags:    map[string]string{"env": "staging"},
+	}
+	entry := &api.ServiceEntry{
+		Node: &api.Node{Address: "10.0.0.1"},
+		Service: &api.AgentService{
+			ID:      serviceID("helloworld.Greeter", node),
+			Address: "127.0.0.1",
+			Port:    8000,
+			Meta:    nodeMeta(node),
+		},
+	}
+
+	got := parseNode(entry)
+	if got.Address != node.Address || got.Weight != 20 || got.Version != "v2" || got.Zone != "az1" ||
+		got.Tags["env"] != "staging" || len(got.Tags) != 1 {
+		t.Fatalf("parseNode() = %+v", got)
+	}
+
+	// instances registered without an address use the address of the consul node
+	entry.Service.Address = ""
+	if got := parseNode(entry); got.Address != "10.0.0.1:8000" {
+		t.Fatalf("parseNode() address = %s", got.Address)
+	}
+}
+
+func TestRegisterInvalidTTL(t *testing.T) {
+	for _, ttl := range []time.Duration{0, -time.Second, 2 * time.Nanosecond} {
+		c := &Consul{consulOpts: defaultOptions(), heartbeats: make(map[string]context.CancelFunc)}
+		c.Configure(WithTTLCheck(ttl))
+		err := c.Register(context.Background(), "helloworld.Greeter", &selector.Node{Address: "127.0.0.1:8000"})
+		if err == nil || !strings.Contains(err.Error(), "ttl") {
+			t.Errorf("Register() with ttl %s = %v, want an invalid ttl error", ttl, err)
+		}
+	}
+}
+
+func TestRegisterReservedTags(t *testing.T) {
+	for _, tag := range []string{"weight", "version", "zone", "namespace"} {
+		c := &Consul{consulOpts: defaultOptions(), heartbeats: make(map[string]context.CancelFunc)}
+		node := &selector.Node{Address: "127.0.0.1:8000", Tags: map[string]string{tag: "x"}}
+		err := c.Register(context.Background(), "helloworld.Greeter", node)
+		if err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Errorf("Register() with tag %s = %v, want a reserved tag error", tag, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package consul
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	TCPCheck = "tcp" // consul dials the server address
+	TTLCheck = "ttl" // the server reports itself alive before the ttl expires
+)
+
+// MinCheckTTL is the shortest ttl of ttl checks
+const MinCheckTTL = time.Second
+
+// Options defines the consul specific settings
+type Options struct {
+	Token                   string        // ACL token
+	Datacenter              string        // datacenter to register to and resolve from, the agent's one if empty
+	TLSConfig               api.TLSConfig // TLS settings to reach the agent, https is used once set
+	CheckType               string        // health check type, tcp or ttl
+	CheckInterval           time.Duration // interval of tcp checks
+	CheckTimeout            time.Duration // timeout of tcp checks
+	CheckTTL                time.Duration // ttl of ttl checks, the server passes the check every ttl/3
+	DeregisterCriticalAfter time.Duration // consul removes instances whose check stays critical longer
+}
+
+type Option func(*Options)
+
+func defaultOptions() *Options {
+	return &Options{
+		CheckType:               TCPCheck,
+		CheckInterval:           10 * time.Second,
+		CheckTimeout:            2 * time.Second,
+		CheckTTL:                15 * time.Second,
+		DeregisterCriticalAfter: time.Minute,
+	}
+}
+
+// WithToken returns an Option which sets the ACL token
+func WithToken(token string) Option {
+	return func(o *Options) {
+		o.Token = token
+	}
+}
+
+// WithDatacenter returns an Option which sets the datacenter
+func WithDatacenter(datacenter string) Option {
+	return func(o *Options) {
+		o.Datacenter = datacenter
+	}
+}
+
+// WithTLSConfig returns an Option which sets the TLS settings used to reach the agent
+func WithTLSConfig(tlsConfig api.TLSConfig) Option {
+	return func(o *Options) {
+		o.TLSConfig = tlsConfig
+	}
+}
+
+// WithTCPCheck returns an Option which makes consul check the server address every interval
+func WithTCPCheck(interval, timeout time.Duration) Option {
+	return func(o *Options) {
+		o.CheckType = TCPCheck
+		o.CheckInterval = interval
+		o.CheckTimeout = timeout
+	}
+}
+
+// WithTTLCheck returns an Option which makes the server report itself alive within every ttl,
+// which must be at least MinCheckTTL
+func WithTTLCheck(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.CheckType = TTLCheck
+		o.CheckTTL = ttl
+	}
+}
+
+// WithDeregisterCriticalAfter returns an Option which sets how long an instance may stay critical before consul removes it
+func WithDeregisterCriticalAfter(d time.Duration) Option {
+	return func(o *Options) {
+		o.DeregisterCriticalAfter = d
+	}
+}
+
+func (o *Options) tlsEnabled() bool {
+	t := o.TLSConfig
+	return t.CAFile != "" || t.CAPath != "" || len(t.CAPem) > 0 || t.CertFile != "" ||
+		len(t.CertPEM) > 0 || t.InsecureSkipVerify
+}
+
+func (o *Options) validate() error {
+	if o.CheckType == TTLCheck && o.CheckTTL < MinCheckTTL {
+		return fmt.Errorf("invalid ttl check %s, ttl must be at least %s", o.CheckTTL, MinCheckTTL)
+	}
+	return nil
+}
@@ -34,11 +34,15 @@ func Register(name string, plugin Plugin) {
 
 // Options for all plug-ins
 type Options struct {
-	SvrAddr         string   // server address
-	Services        []string // service arrays
-	SelectorSvrAddr string   // server discovery address ，e.g. consul server address
-	TracingSvrAddr  string   // tracing server address，e.g. jaeger server address
-	MetricsEndpoint string   // metrics endpoint, e.g. :9300/metrics
+	SvrAddr         string            // server address
+	Services        []string          // service arrays
+	SelectorSvrAddr string            // server discovery address ，e.g. consul server address
+	TracingSvrAddr  string            // tracing server address，e.g. jaeger server address
+	MetricsEndpoint string            // metrics endpoint, e.g. :9300/metrics
+	Weight          int               // load balancing weight of the server
+	Version         string            // version of the server
+	Zone            string            // availability zone of the server
+	Tags            map[string]string // arbitrary metadata of the server
 }
 
 // Option provides operations on Options
@@ -71,3 +75,31 @@ func WithTracingSvrAddr(addr string) Option {
 		o.TracingSvrAddr = addr
 	}
 }
+
+// WithWeight allows you to set Weight of Options
+func WithWeight(weight int) Option {
+	return func(o *Options) {
+		o.Weight = weight
+	}
+}
+
+// WithVersion allows you to set Version of Options
+func WithVersion(version string) Option {
+	return func(o *Options) {
+		o.Version = version
+	}
+}
+
+// WithZone allows you to set Zone of Options
+func WithZone(zone string) Option {
+	return func(o *Options) {
+		o.Zone = zone
+	}
+}
+
+// WithTags allows you to set Tags of Options
+func WithTags(tags map[string]string) Option {
+	return func(o *Options) {
+		o.Tags = tags
+	}
+}
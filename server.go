@@ -3,23 +3,37 @@ package zRPC
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"reflect"
 	"syscall"
 
+	"github.com/WeilunZ/zRPC/components/codec"
 	"github.com/WeilunZ/zRPC/components/log"
+	"github.com/WeilunZ/zRPC/components/state"
 
 	"github.com/WeilunZ/zRPC/components/interceptor"
+	"github.com/WeilunZ/zRPC/components/protocol"
+	"github.com/WeilunZ/zRPC/components/registry"
+	"github.com/WeilunZ/zRPC/components/selector"
+	"github.com/WeilunZ/zRPC/components/utils"
+	"github.com/golang/protobuf/proto"
 
 	"github.com/WeilunZ/zRPC/plugin"
+	"github.com/WeilunZ/zRPC/transport"
 )
 
 type Server struct {
-	opts     *ServerOptions
-	services map[string]Service
-	plugins  []plugin.Plugin
-	closing  bool
+	opts       *ServerOptions
+	services   map[string]Service
+	plugins    []plugin.Plugin
+	registry   registry.Registry
+	transport  transport.ServerTransport // serves all the services of the server
+	httpServer *http.Server              // http/json gateway, if any
+	ctx        context.Context
+	cancel     context.CancelFunc
+	closing    bool
 }
 
 func NewServer(opt ...ServerOption) *Server {
@@ -31,6 +45,7 @@ func NewServer(opt ...ServerOption) *Server {
 	for _, o := range opt {
 		o(s.opts)
 	}
+	s.registry = s.opts.Registry
 	for name, plugin := range plugin.PluginMap {
 		if !s.containPlugin(name) {
 			continue
@@ -49,6 +64,13 @@ func (s *Server) containPlugin(name string) bool {
 	return false
 }
 
+// RegisterService registers the exported methods of svr under serviceName. Methods are of the forms
+//
+//	func (t *T) Method(ctx context.Context, req *Req) (*Rsp, error)
+//	func (t *T) Method(ctx context.Context, args Args, reply *Reply) error // net/rpc
+//
+// with or without the context. Methods of other forms are skipped with a warning, registration
+// fails only if svr has no valid method.
 func (s *Server) RegisterService(serviceName string, svr interface{}) error {
 	// 基于反射
 	serviceType := reflect.TypeOf(svr)
@@ -58,74 +80,138 @@ func (s *Server) RegisterService(serviceName string, svr interface{}) error {
 		HandlerType: (*interface{})(nil),
 		Svr:         svr,
 	}
-	methods, err := getServiceMethods(serviceType, serviceValue)
-	if err != nil {
-		return err
+	methods := getServiceMethods(serviceName, serviceType, serviceValue)
+	if len(methods) == 0 {
+		return fmt.Errorf("service %s has no valid method", serviceName)
 	}
 	sd.Methods = methods
 	s.Register(sd, svr)
 	return nil
 }
 
-func getServiceMethods(serviceType reflect.Type, serviceValue reflect.Value) ([]*Method, error) {
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// methodType describes how a method registered by reflection is called
+type methodType struct {
+	method    reflect.Method
+	withCtx   bool         // the method takes a context first
+	reqType   reflect.Type // type of the request, any type for net/rpc methods
+	replyType reflect.Type // type of the reply of net/rpc methods, nil for the methods returning their response
+}
+
+func getServiceMethods(serviceName string, serviceType reflect.Type, serviceValue reflect.Value) []*Method {
 	methods := make([]*Method, 0)
 	for i := 0; i < serviceType.NumMethod(); i++ {
-		m := serviceType.Method(i)
-		if err := validateMethod(m.Type); err != nil {
-			return nil, err
+		mt, err := validateMethod(serviceType.Method(i))
+		if err != nil {
+			log.Warningf("%s skipped, %v", serviceName, err)
+			continue
 		}
 		method := &Method{
-			MethodName: m.Name,
+			MethodName: mt.method.Name,
 			Handler: func(service interface{}, ctx context.Context, deserialize func(interface{}) error, interceptors []interceptor.ServerInterceptor) (interface{}, error) {
-				reqType := m.Type.In(2)
-				req := reflect.New(reqType.Elem()).Interface()
-				if err := deserialize(req); err != nil {
+				req := mt.newRequest()
+				if err := deserialize(req.Interface()); err != nil {
 					return nil, err
 				}
 				if len(interceptors) == 0 {
-					values := m.Func.Call([]reflect.Value{serviceValue, reflect.ValueOf(ctx), reflect.ValueOf(req)})
-					return values[0].Interface(), nil
+					return mt.call(serviceValue, ctx, req)
 				}
 				handler := func(ctx context.Context, reqbody interface{}) (interface{}, error) {
-					values := m.Func.Call([]reflect.Value{serviceValue, reflect.ValueOf(ctx), reflect.ValueOf(req)})
-					return values[0].Interface(), nil
+					return mt.call(serviceValue, ctx, req)
 				}
-				return interceptor.ServerIntercept(ctx, req, interceptors, handler)
+				return interceptor.ServerIntercept(ctx, req.Interface(), interceptors, handler)
 			},
 		}
 		methods = append(methods, method)
 	}
-	return methods, nil
+	return methods
 }
 
-func validateMethod(m reflect.Type) error {
-	if m.NumIn() < 3 {
-		return fmt.Errorf("method %s invalid, must have at least 2 params", m.Name())
+// newRequest returns a pointer to a new request of the method
+func (mt *methodType) newRequest() reflect.Value {
+	if mt.reqType.Kind() == reflect.Ptr {
+		return reflect.New(mt.reqType.Elem())
 	}
-	if m.NumOut() != 2 {
-		return fmt.Errorf("method %s invalid, must return 2 values", m.Name())
+	return reflect.New(mt.reqType)
+}
+
+// call calls the method with the request req points to and returns its response
+func (mt *methodType) call(serviceValue reflect.Value, ctx context.Context, req reflect.Value) (interface{}, error) {
+	in := []reflect.Value{serviceValue}
+	if mt.withCtx {
+		in = append(in, reflect.ValueOf(ctx))
 	}
-	//parameter1: context
-	if !m.In(1).Implements(reflect.TypeOf((*context.Context)(nil)).Elem()) {
-		return fmt.Errorf("method %s invalid, first param must be context type", m.Name())
+	if mt.reqType.Kind() == reflect.Ptr {
+		in = append(in, req)
+	} else {
+		in = append(in, req.Elem())
 	}
-	//parameter2: pointer
-	if m.In(2).Kind() != reflect.Ptr {
-		return fmt.Errorf("method %s invalid, second param must be pointer", m.Name())
+
+	if mt.replyType == nil {
+		values := mt.method.Func.Call(in)
+		if err, _ := values[1].Interface().(error); err != nil {
+			return nil, err
+		}
+		return values[0].Interface(), nil
 	}
-	// return type 1 : pointer
-	// return type 2 : error
-	replyType := m.Out(0)
-	if replyType.Kind() != reflect.Ptr {
-		return fmt.Errorf("method %s invalid, reply type must be pointer", m.Name())
+
+	reply := reflect.New(mt.replyType.Elem())
+	values := mt.method.Func.Call(append(in, reply))
+	if err, _ := values[0].Interface().(error); err != nil {
+		return nil, err
 	}
+	return reply.Interface(), nil
+}
 
-	errType := m.Out(1)
-	if !errType.Implements(reflect.TypeOf((*error)(nil)).Elem()) {
-		return fmt.Errorf("method %s invalid, second param must implements error", m.Name())
+func validateMethod(m reflect.Method) (*methodType, error) {
+	mt := &methodType{method: m}
+	// params after the receiver
+	params := make([]reflect.Type, 0, m.Type.NumIn())
+	for i := 1; i < m.Type.NumIn(); i++ {
+		params = append(params, m.Type.In(i))
+	}
+	//parameter1: optional context
+	if len(params) > 0 && params[0].Implements(contextType) {
+		mt.withCtx = true
+		params = params[1:]
 	}
-	return nil
 
+	switch m.Type.NumOut() {
+	case 2:
+		// (req *Req) (*Rsp, error)
+		if len(params) != 1 {
+			return nil, fmt.Errorf("method %s invalid, must take a request", m.Name)
+		}
+		if params[0].Kind() != reflect.Ptr {
+			return nil, fmt.Errorf("method %s invalid, request must be pointer", m.Name)
+		}
+		if m.Type.Out(0).Kind() != reflect.Ptr {
+			return nil, fmt.Errorf("method %s invalid, reply type must be pointer", m.Name)
+		}
+		if m.Type.Out(1) != errorType {
+			return nil, fmt.Errorf("method %s invalid, second return value must be error", m.Name)
+		}
+	case 1:
+		// (args Args, reply *Reply) error
+		if len(params) != 2 {
+			return nil, fmt.Errorf("method %s invalid, must take args and reply", m.Name)
+		}
+		if params[1].Kind() != reflect.Ptr {
+			return nil, fmt.Errorf("method %s invalid, reply must be pointer", m.Name)
+		}
+		if m.Type.Out(0) != errorType {
+			return nil, fmt.Errorf("method %s invalid, must return error", m.Name)
+		}
+		mt.replyType = params[1]
+	default:
+		return nil, fmt.Errorf("method %s invalid, must return 1 or 2 values", m.Name)
+	}
+	mt.reqType = params[0]
+	return mt, nil
 }
 
 func (s *Server) Register(sd *ServiceDesc, svr interface{}) {
@@ -152,16 +238,10 @@ func (s *Server) Register(sd *ServiceDesc, svr interface{}) {
 }
 
 func (s *Server) Serve() {
-	err := s.InitPlugins()
-	if err != nil {
+	if err := s.Start(); err != nil {
 		panic(err)
 	}
 
-
-	for _, service := range s.services {
-		go service.Serve(s.opts)
-	}
-
 	// gracefully shutdown
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGSEGV)
@@ -169,14 +249,125 @@ func (s *Server) Serve() {
 	s.Close()
 }
 
+// Start listens on the server address and registers the services, it does not block
+func (s *Server) Start() error {
+	if err := s.InitPlugins(); err != nil {
+		return err
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.transport = transport.GetServerTransport(s.opts.Protocol,
+		transport.WithServerAddress(s.opts.Address),
+		transport.WithServerNetwork(s.opts.Network),
+		transport.WithHandler(s),
+		transport.WithServerTimeout(s.opts.Timeout),
+		transport.WithSerialization(s.opts.SerializationType),
+		transport.WithProtocol(s.opts.Protocol),
+		transport.WithSocketMode(s.opts.SocketMode),
+		transport.WithServerTLSConfig(s.opts.TLSConfig),
+		transport.WithSniffing(s.opts.Sniffing),
+		transport.WithHTTPHandler(s),
+	)
+	// services are ready before the first request comes in
+	for _, service := range s.services {
+		service.Serve(s.opts)
+	}
+
+	if err := s.transport.ListenAndServe(s.ctx); err != nil {
+		log.Errorf("%s serve error, %v", s.opts.Network, err)
+		return err
+	}
+
+	if s.opts.HTTPAddress != "" {
+		if err := s.serveHTTP(); err != nil {
+			log.Errorf("http gateway serve error, %v", err)
+			s.cancel()
+			return err
+		}
+	}
+
+	return s.register()
+}
+
+// Handle dispatches a request to the service it is sent to
+func (s *Server) Handle(ctx context.Context, reqbuf []byte) ([]byte, error) {
+	request := &protocol.Request{}
+	if err := proto.Unmarshal(reqbuf, request); err != nil {
+		return nil, err
+	}
+	return s.HandleRequest(ctx, request, s.opts.SerializationType)
+}
+
+// HandleRequest dispatches a request whose payload and response are serialized with serializationType
+func (s *Server) HandleRequest(ctx context.Context, request *protocol.Request, serializationType string) ([]byte, error) {
+	serviceName, _, err := utils.ParseServicePath(request.ServicePath)
+	if err != nil {
+		return nil, state.NewFrameworkError(state.NotFound, fmt.Sprintf("invalid method %s", request.ServicePath))
+	}
+	registered, ok := s.services[serviceName]
+	if !ok {
+		return nil, state.NewFrameworkError(state.NotFound, fmt.Sprintf("service %s unregistered", serviceName))
+	}
+	service, ok := registered.(RequestService)
+	if !ok {
+		return nil, state.NewFrameworkError(state.InternalError, fmt.Sprintf("service %s does not serve requests", serviceName))
+	}
+	return service.HandleRequest(ctx, request, codec.GetSerialization(serializationType))
+}
+
 func (s *Server) Close() {
-	s.closing = false
+	s.closing = true
 
+	s.deregister()
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.httpServer != nil {
+		s.httpServer.Close()
+	}
 	for _, service := range s.services {
 		service.Close()
 	}
 }
 
+// node describes this server to the registry
+func (s *Server) node() *selector.Node {
+	return &selector.Node{
+		Address: s.opts.Address,
+		Weight:  s.opts.Weight,
+		Version: s.opts.Version,
+		Zone:    s.opts.Zone,
+		Tags:    s.opts.Tags,
+	}
+}
+
+func (s *Server) register() error {
+	if s.registry == nil {
+		return nil
+	}
+	for _, service := range s.services {
+		serviceKey := selector.ServiceKey(s.opts.Namespace, service.Name())
+		if err := s.registry.Register(context.Background(), serviceKey, s.node()); err != nil {
+			log.Errorf("register service %s error, %v", service.Name(), err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) deregister() {
+	if s.registry == nil {
+		return
+	}
+	for _, service := range s.services {
+		serviceKey := selector.ServiceKey(s.opts.Namespace, service.Name())
+		if err := s.registry.Deregister(context.Background(), serviceKey, s.node()); err != nil {
+			log.Errorf("deregister service %s error, %v", service.Name(), err)
+		}
+	}
+}
+
 func (s *Server) InitPlugins() error {
 	// init plugins
 	for _, p := range s.plugins {
@@ -185,19 +376,28 @@ func (s *Server) InitPlugins() error {
 
 		case plugin.ResolverPlugin:
 			var services []string
-			for _, ss := range s.services{
+			for _, ss := range s.services {
 				services = append(services, ss.Name())
 			}
 			pluginOpts := []plugin.Option{
 				plugin.WithSelectorSvrAddr(s.opts.SelectorSvrAddr),
 				plugin.WithSvrAddr(s.opts.Address),
 				plugin.WithServices(services),
+				plugin.WithWeight(s.opts.Weight),
+				plugin.WithVersion(s.opts.Version),
+				plugin.WithZone(s.opts.Zone),
+				plugin.WithTags(s.opts.Tags),
 			}
 			if err := val.Init(pluginOpts...); err != nil {
 				log.Errorf("resolver init error, %v", err)
 				return err
 			}
 
+			// resolver plugins backed by a registry register the services unless a registry is given
+			if r, ok := val.(registry.Registry); ok && s.registry == nil {
+				s.registry = r
+			}
+
 		default:
 
 		}
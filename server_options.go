@@ -1,9 +1,13 @@
 package zRPC
 
 import (
+	"crypto/tls"
+	"os"
 	"time"
 
+	"github.com/WeilunZ/zRPC/components/credentials"
 	"github.com/WeilunZ/zRPC/components/interceptor"
+	"github.com/WeilunZ/zRPC/components/registry"
 )
 
 type ServerOptions struct {
@@ -17,6 +21,19 @@ type ServerOptions struct {
 	TracingSpanName   string   // tracing span name, required when using the third-party tracing plugin
 	PluginNames       []string // plugin name
 	Interceptors      []interceptor.ServerInterceptor
+	Weight            int                       // load balancing weight published to the registry
+	Version           string                    // service version published to the registry
+	Zone              string                    // availability zone published to the registry
+	Tags              map[string]string         // arbitrary metadata published to the registry
+	Registry          registry.Registry         // registry the services are registered to, defaults to the resolver plugin if any
+	Namespace         string                    // namespace the services are registered in, e.g. staging, production
+	SocketMode        os.FileMode               // permissions of the socket file when serving over unix, e.g. 0660
+	TLSConfig         *tls.Config               // serves over tls once set, see the tlsconfig package for reloadable configs
+	Authenticator     credentials.Authenticator // validates the credentials of the calls before their handler runs
+	Authorizer        credentials.Authorizer    // rejects the calls the caller may not make before their request is decoded
+	HTTPAddress       string                    // address of the http/json gateway, disabled if empty
+	HTTPHeaders       []string                  // http headers passed to the handlers as metadata by the gateway
+	Sniffing          bool                      // serves zRPC, json-rpc and the http gateway on the server address
 }
 
 type ServerOption func(*ServerOptions)
@@ -33,6 +50,53 @@ func WithNetwork(network string) ServerOption {
 	}
 }
 
+// WithSocketMode sets the permissions of the socket file when serving over unix
+func WithSocketMode(mode os.FileMode) ServerOption {
+	return func(o *ServerOptions) {
+		o.SocketMode = mode
+	}
+}
+
+// WithTLSConfig serves over tls, clients are authenticated too when the config verifies client certificates
+func WithTLSConfig(cfg *tls.Config) ServerOption {
+	return func(o *ServerOptions) {
+		o.TLSConfig = cfg
+	}
+}
+
+// WithAuthenticator rejects the calls the authenticator does not accept with an Unauthenticated error,
+// the principal of the accepted calls is available to their handler through credentials.PrincipalFromContext
+func WithAuthenticator(authenticator credentials.Authenticator) ServerOption {
+	return func(o *ServerOptions) {
+		o.Authenticator = authenticator
+	}
+}
+
+// WithAuthorizer rejects the calls the authorizer denies, before their request is decoded and with the
+// error of the authorizer, e.g. a PermissionDenied error. Calls are authenticated first.
+func WithAuthorizer(authorizer credentials.Authorizer) ServerOption {
+	return func(o *ServerOptions) {
+		o.Authorizer = authorizer
+	}
+}
+
+// WithHTTPGateway serves the methods as POST /{service}/{method} with json bodies on address too,
+// the given http headers are passed to the handlers as metadata under their lower case name
+func WithHTTPGateway(address string, headers ...string) ServerOption {
+	return func(o *ServerOptions) {
+		o.HTTPAddress = address
+		o.HTTPHeaders = headers
+	}
+}
+
+// WithSniffing serves zRPC frames, json-rpc messages and the http gateway on the server address,
+// recognizing the protocol of every connection from its first bytes
+func WithSniffing(sniffing bool) ServerOption {
+	return func(o *ServerOptions) {
+		o.Sniffing = sniffing
+	}
+}
+
 func WithProtocol(protocol string) ServerOption {
 	return func(o *ServerOptions) {
 		o.Protocol = protocol
@@ -80,3 +144,39 @@ func WithInterceptors(interceptors []interceptor.ServerInterceptor) ServerOption
 		o.Interceptors = interceptors
 	}
 }
+
+func WithWeight(weight int) ServerOption {
+	return func(o *ServerOptions) {
+		o.Weight = weight
+	}
+}
+
+func WithVersion(version string) ServerOption {
+	return func(o *ServerOptions) {
+		o.Version = version
+	}
+}
+
+func WithZone(zone string) ServerOption {
+	return func(o *ServerOptions) {
+		o.Zone = zone
+	}
+}
+
+func WithTags(tags map[string]string) ServerOption {
+	return func(o *ServerOptions) {
+		o.Tags = tags
+	}
+}
+
+func WithRegistry(registry registry.Registry) ServerOption {
+	return func(o *ServerOptions) {
+		o.Registry = registry
+	}
+}
+
+func WithNamespace(namespace string) ServerOption {
+	return func(o *ServerOptions) {
+		o.Namespace = namespace
+	}
+}
@@ -1,9 +1,38 @@
 package zRPC
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/WeilunZ/zRPC/client"
+	"github.com/WeilunZ/zRPC/components/authz"
+	"github.com/WeilunZ/zRPC/components/codec"
+	"github.com/WeilunZ/zRPC/components/credentials"
+	"github.com/WeilunZ/zRPC/components/interceptor"
+	"github.com/WeilunZ/zRPC/components/peer"
+	"github.com/WeilunZ/zRPC/components/state"
+	"github.com/WeilunZ/zRPC/components/tlsconfig"
+	"github.com/WeilunZ/zRPC/transport"
 )
 
 func TestReflect(t *testing.T) {
@@ -18,3 +47,894 @@ func TestReflect(t *testing.T) {
 		fmt.Println(ft.Out(i).Name())
 	}
 }
+
+type greeter struct {
+	name string
+}
+
+type helloRequest struct {
+	Msg string
+}
+
+type helloResponse struct {
+	Msg string
+}
+
+func (g *greeter) SayHello(ctx context.Context, req *helloRequest) (*helloResponse, error) {
+	return &helloResponse{Msg: g.name}, nil
+}
+
+func freeAddress(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+func TestIndependentServers(t *testing.T) {
+	addrs := make(map[string]string)
+	for _, name := range []string{"first", "second"} {
+		addr := freeAddress(t)
+		s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack))
+		if err := s.RegisterService("helloworld.Greeter", &greeter{name: name}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		addrs[name] = addr
+	}
+
+	for name, addr := range addrs {
+		c := client.NewClient(client.WithTarget(addr), client.WithNetwork("tcp"), client.WithTimeout(time.Second))
+		rsp := &helloResponse{}
+		if err := c.Call(context.Background(), "/helloworld.Greeter/SayHello", &helloRequest{Msg: "hello"}, rsp); err != nil {
+			t.Fatal(err)
+		}
+		if rsp.Msg != name {
+			t.Fatalf("server at %s answered %s, want %s", addr, rsp.Msg, name)
+		}
+	}
+}
+
+func TestUnixSocketServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "greeter.sock")
+
+	s := NewServer(WithAddress(path), WithNetwork("unix"), WithSocketMode(0600), WithSerializationType(codec.MsgPack))
+	if err := s.RegisterService("helloworld.Greeter", &greeter{name: "unix"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("socket file = %v, %v", info, err)
+	}
+
+	c := client.NewClient(client.WithTarget("unix://"+path), client.WithTimeout(time.Second))
+	rsp := &helloResponse{}
+	if err := c.Call(context.Background(), "/helloworld.Greeter/SayHello", &helloRequest{Msg: "hello"}, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Msg != "unix" {
+		t.Fatalf("response = %s", rsp.Msg)
+	}
+
+	// a second server cannot take over a socket in use
+	other := NewServer(WithAddress(path), WithNetwork("unix"))
+	if err := other.Start(); err == nil {
+		other.Close()
+		t.Fatal("expected the socket to be in use")
+	}
+
+	s.Close()
+	waitRemoved(t, path)
+}
+
+func waitRemoved(t *testing.T, path string) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not removed", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUdpServer(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	s := NewServer(WithAddress(addr), WithNetwork("udp"), WithSerializationType(codec.MsgPack))
+	if err := s.RegisterService("helloworld.Greeter", &greeter{name: "udp"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c := client.NewClient(client.WithTarget(addr), client.WithNetwork("udp"), client.WithTimeout(time.Second))
+	rsp := &helloResponse{}
+	if err := c.Call(context.Background(), "/helloworld.Greeter/SayHello", &helloRequest{Msg: "hello"}, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Msg != "udp" {
+		t.Fatalf("response = %s", rsp.Msg)
+	}
+
+	large := &helloRequest{Msg: strings.Repeat("x", transport.MaxDatagramSize)}
+	if err := c.Call(context.Background(), "/helloworld.Greeter/SayHello", large, rsp); err != transport.ErrDatagramTooLarge {
+		t.Fatalf("oversized request error = %v", err)
+	}
+
+	err = c.Call(context.Background(), "/helloworld.Greeter/SayHello", &helloRequest{Msg: "hello"}, rsp, client.WithTLSConfig(&tls.Config{}))
+	if err != transport.ErrTLSOverUDP {
+		t.Fatalf("tls request error = %v", err)
+	}
+}
+
+// dropFirstResponse relays the datagrams of a client to the server at addr and back, dropping
+// the first response
+func dropFirstResponse(t *testing.T, addr string) (string, func()) {
+	proxy, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream, err := net.Dial("udp", addr)
+	if err != nil {
+		proxy.Close()
+		t.Fatal(err)
+	}
+
+	clients := make(chan net.Addr, 1)
+	go func() {
+		buf := make([]byte, transport.MaxDatagramSize)
+		for {
+			n, from, err := proxy.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case clients <- from:
+			default:
+			}
+			upstream.Write(buf[:n])
+		}
+	}()
+	go func() {
+		buf := make([]byte, transport.MaxDatagramSize)
+		client := <-clients
+		for dropped := false; ; dropped = true {
+			n, err := upstream.Read(buf)
+			if err != nil {
+				return
+			}
+			if dropped {
+				proxy.WriteTo(buf[:n], client)
+			}
+		}
+	}()
+	return proxy.LocalAddr().String(), func() {
+		proxy.Close()
+		upstream.Close()
+	}
+}
+
+func TestUdpRetransmit(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := conn.LocalAddr().String()
+	conn.Close()
+
+	// the signed retransmits of a call whose response was lost are not rejected as replays
+	s := NewServer(WithAddress(addr), WithNetwork("udp"), WithSerializationType(codec.MsgPack),
+		WithAuthenticator(credentials.HMACAuthenticator(map[string][]byte{"billing": []byte("secret")}, time.Minute)))
+	if err := s.RegisterService("principal", &principal{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	proxyAddr, stop := dropFirstResponse(t, addr)
+	defer stop()
+
+	c := client.NewClient(client.WithTarget(proxyAddr), client.WithNetwork("udp"), client.WithTimeout(time.Second),
+		client.WithRetransmitInterval(50*time.Millisecond))
+	rsp := &helloResponse{}
+	err = c.Call(context.Background(), "/principal/Name", &helloRequest{}, rsp,
+		client.WithCredentials(credentials.NewHMAC("billing", []byte("secret"))))
+	if err != nil || rsp.Msg != "billing" {
+		t.Fatalf("Call() = %s, %v", rsp.Msg, err)
+	}
+}
+
+type whoami struct{}
+
+func (w *whoami) Identity(ctx context.Context, req *helloRequest) (*helloResponse, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no peer")
+	}
+	return &helloResponse{Msg: p.Identity}, nil
+}
+
+// writeTestCert writes a self-signed certificate for name and its key to dir
+func writeTestCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.DNSNames, template.IPAddresses = nil, []net.IP{ip}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverCert, serverKey := writeTestCert(t, dir, "greeter.internal")
+	clientCert, clientKey := writeTestCert(t, dir, "billing.internal")
+
+	serverTLS, err := tlsconfig.NewServerConfig(tlsconfig.WithCertificate(serverCert, serverKey), tlsconfig.WithCA(clientCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddress(t)
+	s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack), WithTLSConfig(serverTLS))
+	if err := s.RegisterService("whoami", &whoami{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	clientTLS, err := tlsconfig.NewClientConfig(tlsconfig.WithCertificate(clientCert, clientKey),
+		tlsconfig.WithCA(serverCert), tlsconfig.WithServerName("greeter.internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.NewClient(client.WithTarget(addr), client.WithNetwork("tcp"), client.WithTimeout(time.Second),
+		client.WithTLSConfig(clientTLS))
+	rsp := &helloResponse{}
+	if err := c.Call(context.Background(), "/whoami/Identity", &helloRequest{}, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Msg != "billing.internal" {
+		t.Fatalf("peer identity = %s", rsp.Msg)
+	}
+
+	// clients without certificate are turned away
+	anonymousTLS, err := tlsconfig.NewClientConfig(tlsconfig.WithCA(serverCert), tlsconfig.WithServerName("greeter.internal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous := client.NewClient(client.WithTarget(addr), client.WithNetwork("tcp"), client.WithTimeout(time.Second),
+		client.WithTLSConfig(anonymousTLS))
+	if err := anonymous.Call(context.Background(), "/whoami/Identity", &helloRequest{}, rsp); err == nil {
+		t.Fatal("expected the call without client certificate to fail")
+	}
+
+	// without server name the host dialed is verified, an ip address here
+	dialedTLS, err := tlsconfig.NewClientConfig(tlsconfig.WithCertificate(clientCert, clientKey), tlsconfig.WithCA(serverCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialed := client.NewClient(client.WithTarget(addr), client.WithNetwork("tcp"), client.WithTimeout(time.Second),
+		client.WithTLSConfig(dialedTLS))
+	if err := dialed.Call(context.Background(), "/whoami/Identity", &helloRequest{}, rsp); err == nil {
+		t.Fatal("expected the call to a server without certificate for 127.0.0.1 to fail")
+	}
+
+	ipCert, ipKey := writeTestCert(t, dir, "127.0.0.1")
+	ipTLS, err := tlsconfig.NewServerConfig(tlsconfig.WithCertificate(ipCert, ipKey), tlsconfig.WithCA(clientCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipAddr := freeAddress(t)
+	ipServer := NewServer(WithAddress(ipAddr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack), WithTLSConfig(ipTLS))
+	if err := ipServer.RegisterService("whoami", &whoami{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipServer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer ipServer.Close()
+
+	ipClientTLS, err := tlsconfig.NewClientConfig(tlsconfig.WithCertificate(clientCert, clientKey), tlsconfig.WithCA(ipCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = client.NewClient(client.WithTarget(ipAddr), client.WithNetwork("tcp"), client.WithTimeout(time.Second),
+		client.WithTLSConfig(ipClientTLS))
+	if err := c.Call(context.Background(), "/whoami/Identity", &helloRequest{}, rsp); err != nil || rsp.Msg != "billing.internal" {
+		t.Fatalf("Call() to 127.0.0.1 = %s, %v", rsp.Msg, err)
+	}
+}
+
+type principal struct{}
+
+func (p *principal) Name(ctx context.Context, req *helloRequest) (*helloResponse, error) {
+	caller, ok := credentials.PrincipalFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("no principal")
+	}
+	return &helloResponse{Msg: caller.Name}, nil
+}
+
+func TestAuthentication(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack),
+		WithAuthenticator(credentials.APIKeyAuthenticator(map[string]string{"secret-key": "billing"})))
+	if err := s.RegisterService("principal", &principal{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c := client.NewClient(client.WithTarget(addr), client.WithNetwork("tcp"), client.WithTimeout(time.Second))
+	rsp := &helloResponse{}
+	err := c.Call(context.Background(), "/principal/Name", &helloRequest{}, rsp,
+		client.WithCredentials(credentials.NewAPIKey("secret-key")))
+	if err != nil || rsp.Msg != "billing" {
+		t.Fatalf("Call() = %s, %v", rsp.Msg, err)
+	}
+
+	err = c.Call(context.Background(), "/principal/Name", &helloRequest{}, rsp)
+	if e, ok := err.(*state.Error); !ok || e.Code != state.Unauthenticated {
+		t.Fatalf("Call() without credentials = %v", err)
+	}
+}
+
+func TestJSONRPCAuthentication(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithProtocol(codec.JSONRPC),
+		WithAuthenticator(credentials.APIKeyAuthenticator(map[string]string{"secret-key": "billing"})))
+	if err := s.RegisterService("principal", &principal{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	fmt.Fprintf(conn, `[{"jsonrpc":"2.0","method":"principal.Name","meta":{%q:"secret-key"},"id":1},`+
+		`{"jsonrpc":"2.0","method":"principal.Name","id":2}]`, credentials.APIKeyKey)
+	want := `[{"jsonrpc":"2.0","result":{"Msg":"billing"},"id":1},` +
+		`{"jsonrpc":"2.0","error":{"code":-32016,"message":"no credentials"},"id":2}]` + "\n"
+	buf := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != want {
+		t.Fatalf("json-rpc over tcp = %s, %v, want %s", buf, err, want)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	addr := freeAddress(t)
+	policy := &authz.Policy{Rules: []authz.Rule{{Effect: authz.Allow, Principals: []string{"billing"}, Methods: []string{"/principal/*"}}}}
+	s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack),
+		WithAuthenticator(credentials.APIKeyAuthenticator(map[string]string{"billing-key": "billing", "ops-key": "ops"})),
+		WithAuthorizer(authz.NewAuthorizer(policy, authz.WithAudit(func(authz.AuditEntry) {}))))
+	if err := s.RegisterService("principal", &principal{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c := client.NewClient(client.WithTarget(addr), client.WithNetwork("tcp"), client.WithTimeout(time.Second))
+	rsp := &helloResponse{}
+	err := c.Call(context.Background(), "/principal/Name", &helloRequest{}, rsp, client.WithCredentials(credentials.NewAPIKey("billing-key")))
+	if err != nil || rsp.Msg != "billing" {
+		t.Fatalf("Call() = %s, %v", rsp.Msg, err)
+	}
+
+	// denied calls are rejected before their request is decoded
+	for _, key := range []string{"billing-key", "ops-key"} {
+		err = c.Call(context.Background(), "/principal/Name", &helloRequest{}, rsp,
+			client.WithCredentials(credentials.NewAPIKey(key)), client.WithSerializationType(codec.Json))
+		want := uint32(state.InvalidArgument)
+		if key == "ops-key" {
+			want = state.PermissionDenied
+		}
+		if e, ok := err.(*state.Error); !ok || e.Code != want {
+			t.Fatalf("Call() with %s and a json payload = %v, want code %d", key, err, want)
+		}
+	}
+}
+
+func TestHTTPGateway(t *testing.T) {
+	addr, httpAddr := freeAddress(t), freeAddress(t)
+	s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack),
+		WithHTTPGateway(httpAddr, "X-Api-Key"),
+		WithAuthenticator(credentials.APIKeyAuthenticator(map[string]string{"secret-key": "ops"})))
+	if err := s.RegisterService("principal", &principal{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		path, key, body string
+		status          int
+		rsp             string
+	}{
+		{"/principal/Name", "secret-key", `{"Msg":"hi"}`, http.StatusOK, `{"Msg":"ops"}`},
+		{"/principal/Name", "secret-key", "", http.StatusOK, `{"Msg":"ops"}`},
+		{"/principal/Name", "", `{}`, http.StatusUnauthorized, ""},
+		{"/principal/Name", "secret-key", `{"Msg":`, http.StatusBadRequest, ""},
+		{"/principal/Name", "secret-key", `{"Msg":1}`, http.StatusBadRequest, ""},
+		{"/principal/Missing", "secret-key", `{}`, http.StatusNotFound, ""},
+		{"/missing/Name", "secret-key", `{}`, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, "http://"+httpAddr+tt.path, strings.NewReader(tt.body))
+		if tt.key != "" {
+			req.Header.Set("X-Api-Key", tt.key)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.status {
+			t.Errorf("POST %s = %d %s, want %d", tt.path, rsp.StatusCode, body, tt.status)
+			continue
+		}
+		if tt.rsp != "" && string(body) != tt.rsp {
+			t.Errorf("POST %s = %s, want %s", tt.path, body, tt.rsp)
+		}
+	}
+
+	rsp, err := http.Get("http://" + httpAddr + "/principal/Name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d, want %d", rsp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPGatewayAddressInUse(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	addr := freeAddress(t)
+	s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithHTTPGateway(lis.Addr().String(), "X-Api-Key"))
+	if err := s.RegisterService("principal", &principal{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err == nil {
+		s.Close()
+		t.Fatal("Start succeeded on a gateway address in use")
+	}
+
+	// the listener of the failed server is closed, its address can be listened on again
+	deadline := time.Now().Add(time.Second)
+	for {
+		l, err := net.Listen("tcp", addr)
+		if err == nil {
+			l.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("listener of the failed server still open, %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJSONRPC(t *testing.T) {
+	addr, httpAddr := freeAddress(t), freeAddress(t)
+	s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithProtocol(codec.JSONRPC), WithHTTPGateway(httpAddr))
+	if err := s.RegisterService("helloworld.Greeter", &greeter{name: "jsonrpc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	// the notification gets no response
+	fmt.Fprint(conn, `{"jsonrpc":"2.0","method":"helloworld.Greeter.SayHello","params":{}}`+"\n")
+	fmt.Fprint(conn, `[{"jsonrpc":"2.0","method":"helloworld.Greeter.SayHello","params":{"Msg":"hi"},"id":1},`+
+		`{"jsonrpc":"2.0","method":"helloworld.Greeter.Missing","id":2}]`)
+	want := `[{"jsonrpc":"2.0","result":{"Msg":"jsonrpc"},"id":1},` +
+		`{"jsonrpc":"2.0","error":{"code":-32601,"message":"method /helloworld.Greeter/Missing unregistered"},"id":2}]` + "\n"
+	buf := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != want {
+		t.Fatalf("json-rpc over tcp = %s, %v, want %s", buf, err, want)
+	}
+
+	rsp, err := http.Post("http://"+httpAddr+JSONRPCPath, "application/json",
+		strings.NewReader(`{"jsonrpc":"2.0","method":"/helloworld.Greeter/SayHello","params":[{"Msg":"hi"}],"id":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if want := `{"jsonrpc":"2.0","result":{"Msg":"jsonrpc"},"id":"a"}`; string(body) != want {
+		t.Fatalf("json-rpc over http = %s, want %s", body, want)
+	}
+}
+
+func TestSniffing(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack), WithSniffing(true))
+	if err := s.RegisterService("helloworld.Greeter", &greeter{name: "sniffed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c := client.NewClient(client.WithTarget(addr), client.WithNetwork("tcp"), client.WithTimeout(time.Second))
+	rsp := &helloResponse{}
+	if err := c.Call(context.Background(), "/helloworld.Greeter/SayHello", &helloRequest{}, rsp); err != nil || rsp.Msg != "sniffed" {
+		t.Fatalf("Call() = %s, %v", rsp.Msg, err)
+	}
+
+	httpRsp, err := http.Post("http://"+addr+"/helloworld.Greeter/SayHello", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(httpRsp.Body)
+	httpRsp.Body.Close()
+	if want := `{"Msg":"sniffed"}`; string(body) != want {
+		t.Fatalf("POST = %s, want %s", body, want)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	fmt.Fprint(conn, `{"jsonrpc":"2.0","method":"helloworld.Greeter.SayHello","id":1}`)
+	want := `{"jsonrpc":"2.0","result":{"Msg":"sniffed"},"id":1}` + "\n"
+	buf := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != want {
+		t.Fatalf("json-rpc = %s, %v, want %s", buf, err, want)
+	}
+
+	// the frames sniffed are served with their own codec whatever the protocol of the server
+	addr = freeAddress(t)
+	jsonrpc := NewServer(WithAddress(addr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack),
+		WithProtocol(codec.JSONRPC), WithSniffing(true))
+	if err := jsonrpc.RegisterService("helloworld.Greeter", &greeter{name: "sniffed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := jsonrpc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer jsonrpc.Close()
+
+	c = client.NewClient(client.WithTarget(addr), client.WithNetwork("tcp"), client.WithTimeout(time.Second))
+	rsp = &helloResponse{}
+	if err := c.Call(context.Background(), "/helloworld.Greeter/SayHello", &helloRequest{}, rsp); err != nil || rsp.Msg != "sniffed" {
+		t.Fatalf("Call() on a json-rpc server = %s, %v", rsp.Msg, err)
+	}
+}
+
+type arithArgs struct {
+	A, B int
+}
+
+type arithReply struct {
+	C int
+}
+
+type arith struct{}
+
+func (a *arith) Multiply(args *arithArgs, reply *arithReply) error {
+	reply.C = args.A * args.B
+	return nil
+}
+
+func (a *arith) Add(args arithArgs, reply *arithReply) error {
+	reply.C = args.A + args.B
+	return nil
+}
+
+func (a *arith) Sub(ctx context.Context, args *arithArgs, reply *arithReply) error {
+	reply.C = args.A - args.B
+	return nil
+}
+
+func (a *arith) Max(args *arithArgs) (*arithReply, error) {
+	if args.A > args.B {
+		return &arithReply{C: args.A}, nil
+	}
+	return &arithReply{C: args.B}, nil
+}
+
+func (a *arith) Div(args *arithArgs, reply *arithReply) error {
+	if args.B == 0 {
+		return state.New(1, "divide by zero")
+	}
+	reply.C = args.A / args.B
+	return nil
+}
+
+func (a *arith) Mod(args *arithArgs, reply *arithReply) error {
+	if args.B == 0 {
+		return errors.New("integer divide by zero")
+	}
+	reply.C = args.A % args.B
+	return nil
+}
+
+// String is not a valid method, it is skipped
+func (a *arith) String() string {
+	return "arith"
+}
+
+func TestNetRPCStyleMethods(t *testing.T) {
+	addr := freeAddress(t)
+	s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack))
+	if err := s.RegisterService("arith", &arith{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RegisterService("invalid", &helloRequest{}); err == nil {
+		t.Fatal("RegisterService() of a service without valid method succeeded")
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c := client.NewClient(client.WithTarget(addr), client.WithNetwork("tcp"), client.WithTimeout(time.Second))
+	for method, want := range map[string]int{"Multiply": 12, "Add": 7, "Sub": 1, "Max": 4} {
+		rsp := &arithReply{}
+		if err := c.Call(context.Background(), "/arith/"+method, &arithArgs{A: 4, B: 3}, rsp); err != nil || rsp.C != want {
+			t.Errorf("Call(%s) = %d, %v, want %d", method, rsp.C, err, want)
+		}
+	}
+
+	err := c.Call(context.Background(), "/arith/Div", &arithArgs{A: 4}, &arithReply{})
+	if e, ok := err.(*state.Error); !ok || e.Message != "divide by zero" {
+		t.Errorf("Call(Div) = %v, want divide by zero", err)
+	}
+	err = c.Call(context.Background(), "/arith/String", &arithArgs{}, &arithReply{})
+	if e, ok := err.(*state.Error); !ok || e.Code != state.NotFound {
+		t.Errorf("Call(String) = %v, want NotFound", err)
+	}
+
+	// a request which cannot be decoded and an unexpected handler error return different codes
+	err = c.Call(context.Background(), "/arith/Add", &arithArgs{A: 4, B: 3}, &arithReply{}, client.WithSerializationType(codec.Json))
+	if e, ok := err.(*state.Error); !ok || e.Code != state.InvalidArgument {
+		t.Errorf("Call(Add) with a json payload = %v, want InvalidArgument", err)
+	}
+	err = c.Call(context.Background(), "/arith/Mod", &arithArgs{A: 4}, &arithReply{})
+	if e, ok := err.(*state.Error); !ok || e.Code != state.InternalError || e.Code == state.InvalidArgument {
+		t.Errorf("Call(Mod) = %v, want InternalError", err)
+	}
+}
+
+// broadcastGreeter answers after its delay, or fails, and records the peak of the calls in flight
+type broadcastGreeter struct {
+	name           string
+	delay          time.Duration
+	fail           bool
+	inflight, peak *int64
+}
+
+func (g *broadcastGreeter) SayHello(ctx context.Context, req *helloRequest) (*helloResponse, error) {
+	n := atomic.AddInt64(g.inflight, 1)
+	defer atomic.AddInt64(g.inflight, -1)
+	for peak := atomic.LoadInt64(g.peak); n > peak; peak = atomic.LoadInt64(g.peak) {
+		if atomic.CompareAndSwapInt64(g.peak, peak, n) {
+			break
+		}
+	}
+
+	time.Sleep(g.delay)
+	if g.fail {
+		return nil, state.New(1, g.name+" failed")
+	}
+	return &helloResponse{Msg: g.name}, nil
+}
+
+// startGreeters starts a server per greeter and returns their addresses
+func startGreeters(t *testing.T, greeters ...*broadcastGreeter) ([]string, func()) {
+	var (
+		addrs   []string
+		servers []*Server
+	)
+	stop := func() {
+		for _, s := range servers {
+			s.Close()
+		}
+	}
+	for _, g := range greeters {
+		addr := freeAddress(t)
+		s := NewServer(WithAddress(addr), WithNetwork("tcp"), WithSerializationType(codec.MsgPack))
+		if err := s.RegisterService("helloworld.Greeter", g); err != nil {
+			stop()
+			t.Fatal(err)
+		}
+		if err := s.Start(); err != nil {
+			stop()
+			t.Fatal(err)
+		}
+		servers = append(servers, s)
+		addrs = append(addrs, addr)
+	}
+	return addrs, stop
+}
+
+func TestBroadcast(t *testing.T) {
+	var inflight, peak int64
+	greeter := func(name string, delay time.Duration, fail bool) *broadcastGreeter {
+		return &broadcastGreeter{name: name, delay: delay, fail: fail, inflight: &inflight, peak: &peak}
+	}
+	newRsp := func() interface{} { return &helloResponse{} }
+	req := &helloRequest{Msg: "hello"}
+	c := client.NewClient(client.WithNetwork("tcp"), client.WithSerializationType(codec.MsgPack), client.WithTimeout(5*time.Second))
+
+	// the calls run at most concurrency at a time, every node answers
+	addrs, stop := startGreeters(t, greeter("a", 50*time.Millisecond, false), greeter("b", 50*time.Millisecond, false),
+		greeter("c", 50*time.Millisecond, false), greeter("d", 50*time.Millisecond, false))
+	results, err := c.Broadcast(context.Background(), "/helloworld.Greeter/SayHello", req, newRsp,
+		client.WithEndpoints(addrs...), client.WithConcurrency(2))
+	stop()
+	if err != nil || len(results) != 4 {
+		t.Fatalf("Broadcast() = %d results, %v", len(results), err)
+	}
+	names := make(map[string]bool)
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("node %s error = %v", r.Node.Address, r.Err)
+		}
+		names[r.Rsp.(*helloResponse).Msg] = true
+	}
+	if len(names) != 4 {
+		t.Fatalf("responses = %v", names)
+	}
+	if p := atomic.LoadInt64(&peak); p != 2 {
+		t.Fatalf("peak of the calls in flight = %d, want 2", p)
+	}
+
+	// the error of a node is returned in its result
+	addrs, stop = startGreeters(t, greeter("a", 0, false), greeter("b", 0, true), greeter("c", 0, false))
+	results, err = c.Broadcast(context.Background(), "/helloworld.Greeter/SayHello", req, newRsp, client.WithEndpoints(addrs...))
+	stop()
+	if err == nil || len(results) != 3 {
+		t.Fatalf("Broadcast() = %d results, %v", len(results), err)
+	}
+	for _, r := range results {
+		if failing := r.Node.Address == addrs[1]; failing != (r.Err != nil) {
+			t.Fatalf("node %s error = %v", r.Node.Address, r.Err)
+		}
+	}
+
+	// the filters of the client narrow down the nodes called
+	addrs, stop = startGreeters(t, greeter("a", 0, false), greeter("b", 0, false), greeter("c", 0, false))
+	results, err = c.Broadcast(context.Background(), "/helloworld.Greeter/SayHello", req, newRsp,
+		client.WithEndpoints(addrs...), client.WithSubset("broadcaster", 2))
+	stop()
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Broadcast() to a subset = %d results, %v", len(results), err)
+	}
+
+	// the broadcast completes once the policy is met, the calls still in flight are canceled
+	calls := make(chan error, 3)
+	record := func(ctx context.Context, req, rsp interface{}, ivk interceptor.ClientInvoker) error {
+		err := ivk(ctx, req, rsp)
+		calls <- err
+		return err
+	}
+	addrs, stop = startGreeters(t, greeter("fast", 0, false), greeter("slow", 2*time.Second, false), greeter("slow", 2*time.Second, false))
+	defer stop()
+	start := time.Now()
+	results, err = c.Broadcast(context.Background(), "/helloworld.Greeter/SayHello", req, newRsp,
+		client.WithEndpoints(addrs...), client.WithPolicy(client.FirstN(1)), client.WithInterceptor(record))
+	if err != nil || len(results) != 1 || results[0].Rsp.(*helloResponse).Msg != "fast" {
+		t.Fatalf("Broadcast() = %d results, %v", len(results), err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("FirstN(1) completed after %s", elapsed)
+	}
+	canceled := 0
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-calls:
+			if errors.Is(err, context.Canceled) {
+				canceled++
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%d calls still in flight", 3-i)
+		}
+	}
+	if canceled != 2 {
+		t.Fatalf("%d calls canceled, want 2", canceled)
+	}
+
+	addrs, stop = startGreeters(t, greeter("fast", 0, false), greeter("fast", 0, false), greeter("slow", 2*time.Second, false))
+	defer stop()
+	start = time.Now()
+	results, err = c.Broadcast(context.Background(), "/helloworld.Greeter/SayHello", req, newRsp,
+		client.WithEndpoints(addrs...), client.WithPolicy(client.Quorum()))
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Broadcast() = %d results, %v", len(results), err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Quorum() completed after %s", elapsed)
+	}
+}
@@ -3,18 +3,20 @@ package zRPC
 import (
 	"context"
 	"errors"
+	"fmt"
 
+	"github.com/WeilunZ/zRPC/components/credentials"
 	"github.com/WeilunZ/zRPC/components/log"
+	"github.com/WeilunZ/zRPC/components/metadata"
+	"github.com/WeilunZ/zRPC/components/state"
 
 	"github.com/WeilunZ/zRPC/components/utils"
 
 	"github.com/WeilunZ/zRPC/components/codec"
 	"github.com/WeilunZ/zRPC/components/protocol"
-	"github.com/golang/protobuf/proto"
-
-	"github.com/WeilunZ/zRPC/transport"
 
 	"github.com/WeilunZ/zRPC/components/interceptor"
+	"github.com/golang/protobuf/proto"
 )
 
 type Service interface {
@@ -24,11 +26,15 @@ type Service interface {
 	Name() string
 }
 
+// RequestService is a Service serving the requests dispatched to it in the serialization of their transport
+type RequestService interface {
+	Service
+	HandleRequest(context.Context, *protocol.Request, codec.Serialization) ([]byte, error)
+}
+
 type service struct {
-	svr         interface{}        // server
-	ctx         context.Context    // 每一个 service 一个上下文进行管理
-	cancel      context.CancelFunc // context 的控制器
-	serviceName string             // 服务名
+	svr         interface{} // server
+	serviceName string      // 服务名
 	handlers    map[string]Handler
 	opts        *ServerOptions // 参数选项
 	closing     bool           // 服务停止中？
@@ -40,9 +46,6 @@ func (s *service) Name() string {
 
 func (s *service) Close() {
 	s.closing = true
-	if s.cancel != nil {
-		s.cancel()
-	}
 	log.Info("service closing ...")
 }
 
@@ -66,44 +69,54 @@ func (s *service) Register(handlerName string, handler Handler) {
 	s.handlers[handlerName] = handler
 }
 
+// Serve makes the service handle the requests the server transport dispatches to it
 func (s *service) Serve(opts *ServerOptions) {
 	s.opts = opts
-	transportOpts := []transport.ServerTransportOption{
-		transport.WithServerAddress(s.opts.Address),
-		transport.WithServerNetwork(s.opts.Network),
-		transport.WithHandler(s),
-		transport.WithServerTimeout(s.opts.Timeout),
-		transport.WithSerialization(s.opts.SerializationType),
-		transport.WithProtocol(s.opts.Protocol),
-	}
-
-	serverTransport := transport.GetServerTransport(s.opts.Protocol)
-
-	s.ctx, s.cancel = context.WithCancel(context.Background())
-
-	if err := serverTransport.ListenAndServe(s.ctx, transportOpts...); err != nil {
-		log.Errorf("%s serve error, %v", s.opts.Network, err)
-		return
-	}
-
 	log.Infof("%s service serving started at %s ... \n", s.serviceName, s.opts.Address)
 }
 
+// Handle serves a protocol.Request frame body whose payload is serialized with the serialization of the server
 func (s *service) Handle(ctx context.Context, reqbuf []byte) ([]byte, error) {
 	request := &protocol.Request{}
 	if err := proto.Unmarshal(reqbuf, request); err != nil {
 		return nil, err
 	}
+	return s.HandleRequest(ctx, request, codec.GetSerialization(s.opts.SerializationType))
+}
 
-	serverSerialization := codec.GetSerialization(s.opts.SerializationType)
-
+// HandleRequest serves a request whose payload and response are serialized with serverSerialization
+func (s *service) HandleRequest(ctx context.Context, request *protocol.Request, serverSerialization codec.Serialization) ([]byte, error) {
 	dec := func(req interface{}) error {
 		if err := serverSerialization.Deserialize(request.Payload, req); err != nil {
-			return err
+			return state.NewFrameworkError(state.InvalidArgument, fmt.Sprintf("decode request error, %v", err))
 		}
 		return nil
 	}
 
+	md := metadata.FromHeader(request.Metadata)
+	ctx = metadata.WithServerMetadata(ctx, md)
+	ctx = interceptor.WithServerInfo(ctx, &interceptor.ServerInfo{ServicePath: request.ServicePath})
+
+	if s.opts.Authenticator != nil {
+		principal, err := s.opts.Authenticator.Authenticate(ctx, &credentials.CallInfo{
+			ServicePath: request.ServicePath,
+			Metadata:    md,
+			Payload:     request.Payload,
+		})
+		if err != nil {
+			return nil, state.NewFrameworkError(state.Unauthenticated, err.Error())
+		}
+		ctx = credentials.NewContext(ctx, principal)
+	}
+	if s.opts.Authorizer != nil {
+		if err := s.opts.Authorizer.Authorize(ctx, request.ServicePath); err != nil {
+			if _, ok := err.(*state.Error); !ok {
+				err = state.NewFrameworkError(state.PermissionDenied, err.Error())
+			}
+			return nil, err
+		}
+	}
+
 	if s.opts.Timeout != 0 {
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, s.opts.Timeout)
@@ -117,7 +130,7 @@ func (s *service) Handle(ctx context.Context, reqbuf []byte) ([]byte, error) {
 
 	handler := s.handlers[method]
 	if handler == nil {
-		return nil, errors.New("handler unregisterd")
+		return nil, state.NewFrameworkError(state.NotFound, fmt.Sprintf("method %s unregistered", request.ServicePath))
 	}
 	rsp, err := handler(s.svr, ctx, dec, s.opts.Interceptors)
 	if err != nil {
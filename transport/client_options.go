@@ -8,12 +8,14 @@ import (
 )
 
 type ClientTransportOptions struct {
-	Target      string
-	ServiceName string
-	Network     string
-	Pool        connpool.Pool
-	Selector    selector.Selector
-	Timeout     time.Duration
+	Target             string
+	ServiceName        string
+	Network            string
+	Pool               connpool.Pool
+	Selector           selector.Selector
+	SelectOpts         []selector.Option
+	Timeout            time.Duration
+	RetransmitInterval time.Duration // interval before retransmitting a udp request, doubled every time
 }
 
 // Use the Options mode to wrap the ClientTransportOptions
@@ -54,9 +56,23 @@ func WithSelector(selector selector.Selector) ClientTransportOption {
 	}
 }
 
+// WithSelectOptions returns a ClientTransportOption which sets the options of the node selection
+func WithSelectOptions(opts ...selector.Option) ClientTransportOption {
+	return func(o *ClientTransportOptions) {
+		o.SelectOpts = opts
+	}
+}
+
 // WithTimeout returns a ClientTransportOption which sets the value for timeout
 func WithTimeout(timeout time.Duration) ClientTransportOption {
 	return func(o *ClientTransportOptions) {
 		o.Timeout = timeout
 	}
 }
+
+// WithRetransmitInterval returns a ClientTransportOption which sets the interval before retransmitting a udp request
+func WithRetransmitInterval(interval time.Duration) ClientTransportOption {
+	return func(o *ClientTransportOptions) {
+		o.RetransmitInterval = interval
+	}
+}
@@ -3,66 +3,97 @@ package transport
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/selector"
 )
 
 type clientTransport struct {
 	opts *ClientTransportOptions
 }
 
+// ClientTransportFactory builds a client transport whose options are fixed once built
+type ClientTransportFactory func(opts ...ClientTransportOption) ClientTransport
+
 var (
-	clientTransportMap     = make(map[string]ClientTransport)
-	DefaultClientTransport = New()
+	clientTransportMap = make(map[string]ClientTransportFactory)
+	clientTransportMu  sync.RWMutex
 )
 
 func init() {
-	clientTransportMap["default"] = DefaultClientTransport
+	RegisterClientTransport("default", New)
 }
 
-var New = func() ClientTransport {
-	return &clientTransport{
+var New = func(opts ...ClientTransportOption) ClientTransport {
+	c := &clientTransport{
 		opts: &ClientTransportOptions{},
 	}
-}
-
-func RegisterClientTransport(name string, clientTransport ClientTransport) {
-	if clientTransportMap == nil {
-		clientTransportMap = make(map[string]ClientTransport)
+	for _, o := range opts {
+		o(c.opts)
 	}
-	clientTransportMap[name] = clientTransport
+	return c
 }
 
-// Get the ServerTransport
-func GetClientTransport(transport string) ClientTransport {
+// RegisterClientTransport registers the factory of the client transports of a protocol
+func RegisterClientTransport(name string, factory ClientTransportFactory) {
+	clientTransportMu.Lock()
+	defer clientTransportMu.Unlock()
+	clientTransportMap[name] = factory
+}
 
-	if v, ok := clientTransportMap[transport]; ok {
-		return v
+// GetClientTransport builds a client transport with the factory registered under name,
+// or with the default one if there is none
+func GetClientTransport(name string, opts ...ClientTransportOption) ClientTransport {
+	clientTransportMu.RLock()
+	factory, ok := clientTransportMap[name]
+	clientTransportMu.RUnlock()
+	if !ok {
+		factory = New
 	}
-
-	return DefaultClientTransport
+	return factory(opts...)
 }
 
+// Send sends a request and returns the response frame,
+// opts apply to this request only and leave the transport untouched
 func (c *clientTransport) Send(ctx context.Context, req []byte, opts ...ClientTransportOption) ([]byte, error) {
+	sendOpts := *c.opts
 	for _, o := range opts {
-		o(c.opts)
+		o(&sendOpts)
 	}
-	if c.opts.Network == "tcp" {
-		return c.SendTcpReq(ctx, req)
+	ct := &clientTransport{opts: &sendOpts}
+
+	switch ct.opts.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return ct.SendTcpReq(ctx, req)
+	case "udp", "udp4", "udp6":
+		return ct.SendUdpReq(ctx, req)
 	}
 	return nil, fmt.Errorf("network type not supported")
 }
 
+// SendTcpReq sends a request over a stream connection of the pool, tcp or unix
 func (c *clientTransport) SendTcpReq(ctx context.Context, req []byte) ([]byte, error) {
 
+	// calls pinned to a node skip the service discovery
+	if node, ok := selector.NodeFromContext(ctx); ok {
+		return c.roundTrip(ctx, node.Address, req)
+	}
+
 	// service discovery
-	addr, err := c.opts.Selector.Select(c.opts.ServiceName)
+	node, done, err := c.opts.Selector.Select(ctx, c.opts.ServiceName, c.opts.SelectOpts...)
 	if err != nil {
 		return nil, err
 	}
 
-	// defaultSelector returns "", use the target as address
-	if addr == "" {
-		addr = c.opts.Target
-	}
+	start := time.Now()
+	frame, err := c.roundTrip(ctx, node.Address, req)
+	done(selector.DoneInfo{Err: err, Latency: time.Since(start)})
+
+	return frame, err
+}
+
+func (c *clientTransport) roundTrip(ctx context.Context, addr string, req []byte) ([]byte, error) {
 
 	conn, err := c.opts.Pool.Get(ctx, c.opts.Network, addr)
 	//	conn, err := net.DialTimeout("tcp", addr, c.opts.Timeout);
@@ -72,11 +103,35 @@ func (c *clientTransport) SendTcpReq(ctx context.Context, req []byte) ([]byte, e
 
 	defer conn.Close()
 
+	// the reads and writes of a canceled call are unblocked, failing drops the connection from the pool
+	if done := ctx.Done(); done != nil {
+		stop, exited := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(exited)
+			select {
+			case <-done:
+				conn.SetDeadline(time.Now())
+			case <-stop:
+			}
+		}()
+		defer func() {
+			close(stop)
+			<-exited
+			// a call canceled once complete returns a usable connection to the pool
+			if ctx.Err() != nil {
+				conn.SetDeadline(time.Time{})
+			}
+		}()
+	}
+
 	sendNum := 0
 	num := 0
 	for sendNum < len(req) {
 		num, err = conn.Write(req[sendNum:])
 		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
 			return nil, err
 		}
 		sendNum += num
@@ -91,6 +146,9 @@ func (c *clientTransport) SendTcpReq(ctx context.Context, req []byte) ([]byte, e
 	wrapperConn := wrapConn(conn)
 	frame, err := wrapperConn.framer.ReadFrame(conn)
 	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		return nil, err
 	}
 
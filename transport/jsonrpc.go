@@ -0,0 +1,303 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/WeilunZ/zRPC/components/codec"
+	"github.com/WeilunZ/zRPC/components/log"
+	"github.com/WeilunZ/zRPC/components/metadata"
+	"github.com/WeilunZ/zRPC/components/protocol"
+	"github.com/WeilunZ/zRPC/components/state"
+)
+
+// json-rpc 2.0 error codes
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+	// framework errors are returned as JSONRPCServerError - their code, e.g. -32016 for Unauthenticated
+	JSONRPCServerError = -32000
+)
+
+const jsonrpcVersion = "2.0"
+
+var errMessageTooLarge = errors.New("json-rpc message too large")
+
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"` // empty for notifications
+	// Meta is the metadata of the request, e.g. "meta":{"x-api-key":"..."}, a zRPC extension of json-rpc 2.0
+	Meta map[string]string `json:"meta"`
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// HandleJSONRPC serves a json-rpc 2.0 request or batch of requests and returns the response, nil if
+// there is none to send, e.g. for notifications. The methods are named after their service path,
+// e.g. helloworld.Greeter.SayHello or /helloworld.Greeter/SayHello, and take their request as params,
+// either by name or as the only item of an array. md is passed to the handlers as the metadata, on top of
+// the string members of the "meta" object of each request.
+func HandleJSONRPC(ctx context.Context, h RequestHandler, msg []byte, md map[string][]byte) []byte {
+	msg = bytes.TrimSpace(msg)
+	if !json.Valid(msg) {
+		return marshalJSONRPC(newJSONRPCResponse(nil, nil, &jsonrpcError{Code: JSONRPCParseError, Message: "parse error"}))
+	}
+	if msg[0] != '[' {
+		rsp := handleJSONRPCRequest(ctx, h, msg, md)
+		if rsp == nil {
+			return nil
+		}
+		return marshalJSONRPC(rsp)
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(msg, &batch); err != nil || len(batch) == 0 {
+		return marshalJSONRPC(newJSONRPCResponse(nil, nil, &jsonrpcError{Code: JSONRPCInvalidRequest, Message: "invalid request"}))
+	}
+	// the requests of a batch are served by up to GOMAXPROCS workers, their responses keep the order of the batch
+	rsps := make([]*jsonrpcResponse, len(batch))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(batch) {
+		workers = len(batch)
+	}
+	next := int64(-1)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(atomic.AddInt64(&next, 1)); i < len(batch); i = int(atomic.AddInt64(&next, 1)) {
+				rsps[i] = handleJSONRPCRequest(ctx, h, batch[i], md)
+			}
+		}()
+	}
+	wg.Wait()
+
+	replies := make([]*jsonrpcResponse, 0, len(rsps))
+	for _, rsp := range rsps {
+		if rsp != nil {
+			replies = append(replies, rsp)
+		}
+	}
+	if len(replies) == 0 {
+		return nil
+	}
+	return marshalJSONRPC(replies)
+}
+
+// handleJSONRPCRequest serves a single request, it returns nil for notifications
+func handleJSONRPCRequest(ctx context.Context, h RequestHandler, msg []byte, md map[string][]byte) *jsonrpcResponse {
+	req := &jsonrpcRequest{}
+	if err := json.Unmarshal(msg, req); err != nil || req.JSONRPC != jsonrpcVersion || req.Method == "" || !validID(req.ID) {
+		return newJSONRPCResponse(nil, nil, &jsonrpcError{Code: JSONRPCInvalidRequest, Message: "invalid request"})
+	}
+	notification := len(req.ID) == 0
+
+	params, ok := jsonrpcParams(req.Params)
+	if !ok {
+		if notification {
+			return nil
+		}
+		return newJSONRPCResponse(req.ID, nil, &jsonrpcError{Code: JSONRPCInvalidParams, Message: "invalid params"})
+	}
+
+	result, err := h.HandleRequest(ctx, &protocol.Request{
+		ServicePath: jsonrpcServicePath(req.Method),
+		Payload:     params,
+		Metadata:    jsonrpcMetadata(req.Meta, md),
+	}, codec.Json)
+	if notification {
+		if err != nil {
+			log.Errorf("json-rpc notification %s error, %v", req.Method, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return newJSONRPCResponse(req.ID, nil, newJSONRPCError(err))
+	}
+	return newJSONRPCResponse(req.ID, result, nil)
+}
+
+// jsonrpcMetadata returns the metadata of a request, md overrides the keys of meta
+func jsonrpcMetadata(meta map[string]string, md map[string][]byte) map[string][]byte {
+	if len(meta) == 0 {
+		return md
+	}
+	header := metadata.New(meta).ToHeader()
+	for k, v := range md {
+		header[k] = v
+	}
+	return header
+}
+
+func newJSONRPCResponse(id json.RawMessage, result []byte, e *jsonrpcError) *jsonrpcResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &jsonrpcResponse{JSONRPC: jsonrpcVersion, Result: result, Error: e, ID: id}
+}
+
+// newJSONRPCError returns the json-rpc error of the error of a handler
+func newJSONRPCError(err error) *jsonrpcError {
+	e, ok := err.(*state.Error)
+	if !ok {
+		return &jsonrpcError{Code: JSONRPCInternalError, Message: state.InternalErrorMessage}
+	}
+	if e.Type != state.FrameworkError {
+		return &jsonrpcError{Code: int(e.Code), Message: e.Message}
+	}
+	switch e.Code {
+	case state.NotFound:
+		return &jsonrpcError{Code: JSONRPCMethodNotFound, Message: e.Message}
+	case state.InvalidArgument:
+		return &jsonrpcError{Code: JSONRPCInvalidParams, Message: e.Message}
+	}
+	return &jsonrpcError{Code: JSONRPCServerError - int(e.Code), Message: e.Message}
+}
+
+func marshalJSONRPC(v interface{}) []byte {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("json-rpc marshal error, %v", err)
+		return nil
+	}
+	return msg
+}
+
+// validID tells whether id is absent, null, a string or a number
+func validID(id json.RawMessage) bool {
+	if len(id) == 0 {
+		return true
+	}
+	switch id[0] {
+	case '{', '[', 't', 'f':
+		return false
+	}
+	return true
+}
+
+// jsonrpcParams returns the request payload of the params of a request, an object or an array of one object
+func jsonrpcParams(params json.RawMessage) ([]byte, bool) {
+	if len(params) == 0 || string(params) == "null" {
+		return []byte("{}"), true
+	}
+	switch params[0] {
+	case '{':
+		return params, true
+	case '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(params, &items); err != nil || len(items) > 1 {
+			return nil, false
+		}
+		if len(items) == 0 {
+			return []byte("{}"), true
+		}
+		return jsonrpcParams(items[0])
+	}
+	return nil, false
+}
+
+// jsonrpcServicePath returns the service path of a method, e.g. /helloworld.Greeter/SayHello for helloworld.Greeter.SayHello
+func jsonrpcServicePath(method string) string {
+	if strings.HasPrefix(method, "/") {
+		return method
+	}
+	idx := strings.LastIndex(method, ".")
+	if idx <= 0 {
+		return method
+	}
+	return "/" + method[:idx] + "/" + method[idx+1:]
+}
+
+// serveJSONRPC serves the json-rpc messages of a connection until it is closed
+func (s *serverTransport) serveJSONRPC(ctx context.Context, conn net.Conn) error {
+	h, ok := s.opts.Handler.(RequestHandler)
+	if !ok {
+		return errors.New("handler does not support json-rpc")
+	}
+	cdc := codec.GetCodec(codec.JSONRPC)
+
+	reader := &boundedReader{r: conn}
+	dec := json.NewDecoder(reader)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		reader.remaining = MaxPayLoadLength
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// the stream cannot be read past an invalid message
+			if _, ok := err.(*json.SyntaxError); ok {
+				s.writeJSONRPC(ctx, conn, cdc, HandleJSONRPC(ctx, h, raw, nil))
+			}
+			return err
+		}
+
+		msg, err := cdc.Decode(raw)
+		if err != nil {
+			return err
+		}
+		if err := s.writeJSONRPC(ctx, conn, cdc, HandleJSONRPC(ctx, h, msg, nil)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *serverTransport) writeJSONRPC(ctx context.Context, conn net.Conn, cdc codec.Codec, rsp []byte) error {
+	if rsp == nil {
+		return nil
+	}
+	msg, err := cdc.Encode(rsp)
+	if err != nil {
+		return err
+	}
+	return s.write(ctx, conn, msg)
+}
+
+// boundedReader fails once more than remaining bytes are read, bounding the size of the messages decoded
+type boundedReader struct {
+	r         io.Reader
+	remaining int
+}
+
+func (b *boundedReader) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, errMessageTooLarge
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= n
+	return n, err
+}
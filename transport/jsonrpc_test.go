@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/protocol"
+	"github.com/WeilunZ/zRPC/components/state"
+)
+
+// echoHandler echoes the payload of /echo/Echo and fails the other methods
+type echoHandler struct{}
+
+func (echoHandler) HandleRequest(ctx context.Context, request *protocol.Request, serializationType string) ([]byte, error) {
+	switch request.ServicePath {
+	case "/echo/Echo":
+		return request.Payload, nil
+	case "/echo/Deny":
+		return nil, state.NewFrameworkError(state.PermissionDenied, "denied")
+	case "/echo/Fail":
+		return nil, state.New(42, "failed")
+	}
+	return nil, state.NewFrameworkError(state.NotFound, "unregistered")
+}
+
+func TestHandleJSONRPC(t *testing.T) {
+	tests := []struct {
+		name, req, rsp string
+	}{
+		{"by name", `{"jsonrpc":"2.0","method":"echo.Echo","params":{"a":1},"id":1}`,
+			`{"jsonrpc":"2.0","result":{"a":1},"id":1}`},
+		{"by position", `{"jsonrpc":"2.0","method":"/echo/Echo","params":[{"a":1}],"id":"x"}`,
+			`{"jsonrpc":"2.0","result":{"a":1},"id":"x"}`},
+		{"no params", `{"jsonrpc":"2.0","method":"echo.Echo","id":null}`,
+			`{"jsonrpc":"2.0","result":{},"id":null}`},
+		{"notification", `{"jsonrpc":"2.0","method":"echo.Echo","params":{}}`, ``},
+		{"parse error", `{"jsonrpc":`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error"},"id":null}`},
+		{"invalid request", `{"jsonrpc":"1.0","method":"echo.Echo","id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}`},
+		{"invalid meta", `{"jsonrpc":"2.0","method":"echo.Echo","meta":{"a":1},"id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}`},
+		{"invalid params", `{"jsonrpc":"2.0","method":"echo.Echo","params":[1,2],"id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":-32602,"message":"invalid params"},"id":1}`},
+		{"method not found", `{"jsonrpc":"2.0","method":"echo.Missing","id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"unregistered"},"id":1}`},
+		{"framework error", `{"jsonrpc":"2.0","method":"echo.Deny","id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":-32007,"message":"denied"},"id":1}`},
+		{"business error", `{"jsonrpc":"2.0","method":"echo.Fail","id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":42,"message":"failed"},"id":1}`},
+		{"empty batch", `[]`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}`},
+		{"batch", `[{"jsonrpc":"2.0","method":"echo.Echo","params":{"b":2},"id":2},{"jsonrpc":"2.0","method":"echo.Echo"},1]`,
+			`[{"jsonrpc":"2.0","result":{"b":2},"id":2},{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}]`},
+		{"batch of notifications", `[{"jsonrpc":"2.0","method":"echo.Echo"},{"jsonrpc":"2.0","method":"echo.Fail"}]`, ``},
+	}
+	for _, tt := range tests {
+		rsp := HandleJSONRPC(context.Background(), echoHandler{}, []byte(tt.req), nil)
+		if string(rsp) != tt.rsp {
+			t.Errorf("%s : HandleJSONRPC() = %s, want %s", tt.name, rsp, tt.rsp)
+		}
+	}
+}
+
+// slowHandler echoes the payloads after a while and records the peak of the requests in flight
+type slowHandler struct {
+	inflight, peak int64
+}
+
+func (h *slowHandler) HandleRequest(ctx context.Context, request *protocol.Request, serializationType string) ([]byte, error) {
+	n := atomic.AddInt64(&h.inflight, 1)
+	defer atomic.AddInt64(&h.inflight, -1)
+	for peak := atomic.LoadInt64(&h.peak); n > peak; peak = atomic.LoadInt64(&h.peak) {
+		if atomic.CompareAndSwapInt64(&h.peak, peak, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return request.Payload, nil
+}
+
+func TestHandleJSONRPCBatchConcurrency(t *testing.T) {
+	var reqs, rsps []string
+	for i := 0; i < 100; i++ {
+		reqs = append(reqs, fmt.Sprintf(`{"jsonrpc":"2.0","method":"echo.Echo","params":{"i":%d},"id":%d}`, i, i))
+		rsps = append(rsps, fmt.Sprintf(`{"jsonrpc":"2.0","result":{"i":%d},"id":%d}`, i, i))
+	}
+	h := &slowHandler{}
+	rsp := HandleJSONRPC(context.Background(), h, []byte("["+strings.Join(reqs, ",")+"]"), nil)
+	if want := "[" + strings.Join(rsps, ",") + "]"; string(rsp) != want {
+		t.Fatalf("HandleJSONRPC() = %s, want %s", rsp, want)
+	}
+	if peak := atomic.LoadInt64(&h.peak); peak > int64(runtime.GOMAXPROCS(0)) {
+		t.Fatalf("%d requests served concurrently, more than GOMAXPROCS %d", peak, runtime.GOMAXPROCS(0))
+	}
+}
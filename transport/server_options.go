@@ -2,17 +2,26 @@ package transport
 
 import (
 	"context"
+	"crypto/tls"
+	"net/http"
+	"os"
 	"time"
+
+	"github.com/WeilunZ/zRPC/components/protocol"
 )
 
 type ServerTransportOptions struct {
 	Address         string
 	Network         string
 	Timeout         time.Duration
-	Protocol        string // proto, json
+	Protocol        string // proto, jsonrpc
 	Handler         Handler
 	Serialization   string        // serialization type
 	KeepAlivePeriod time.Duration // keepalive period
+	SocketMode      os.FileMode   // permissions of the socket file of unix networks, e.g. 0660
+	TLSConfig       *tls.Config   // serves over tls once set
+	Sniffing        bool          // recognizes the protocol of every connection from its first bytes
+	HTTPHandler     http.Handler  // serves the connections recognized as http by sniffing
 }
 
 type ServerTransportOption func(*ServerTransportOptions)
@@ -21,6 +30,12 @@ type Handler interface {
 	Handle(context.Context, []byte) ([]byte, error)
 }
 
+// RequestHandler handles the requests of protocols carrying their own serialization, e.g. the json
+// requests of json-rpc. The handlers of these protocols must implement it.
+type RequestHandler interface {
+	HandleRequest(ctx context.Context, request *protocol.Request, serializationType string) ([]byte, error)
+}
+
 // WithServerAddress returns a ServerTransportOption which sets the value for address
 func WithServerAddress(address string) ServerTransportOption {
 	return func(o *ServerTransportOptions) {
@@ -68,3 +83,32 @@ func WithKeepAlivePeriod(keepAlivePeriod time.Duration) ServerTransportOption {
 		o.KeepAlivePeriod = keepAlivePeriod
 	}
 }
+
+// WithSocketMode returns a ServerTransportOption which sets the permissions of unix socket files
+func WithSocketMode(mode os.FileMode) ServerTransportOption {
+	return func(o *ServerTransportOptions) {
+		o.SocketMode = mode
+	}
+}
+
+// WithServerTLSConfig returns a ServerTransportOption which serves over tls
+func WithServerTLSConfig(cfg *tls.Config) ServerTransportOption {
+	return func(o *ServerTransportOptions) {
+		o.TLSConfig = cfg
+	}
+}
+
+// WithSniffing returns a ServerTransportOption which serves zRPC frames, json-rpc messages and http
+// requests on the same listener, recognizing the protocol of every connection from its first bytes
+func WithSniffing(sniffing bool) ServerTransportOption {
+	return func(o *ServerTransportOptions) {
+		o.Sniffing = sniffing
+	}
+}
+
+// WithHTTPHandler returns a ServerTransportOption which sets the handler of the connections recognized as http
+func WithHTTPHandler(handler http.Handler) ServerTransportOption {
+	return func(o *ServerTransportOptions) {
+		o.HTTPHandler = handler
+	}
+}
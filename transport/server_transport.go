@@ -2,57 +2,88 @@ package transport
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/WeilunZ/zRPC/components/codec"
 	"github.com/WeilunZ/zRPC/components/log"
+	"github.com/WeilunZ/zRPC/components/peer"
 	"github.com/WeilunZ/zRPC/components/protocol"
 	"github.com/WeilunZ/zRPC/components/state"
 	"github.com/golang/protobuf/proto"
 )
 
+const handshakeTimeout = 10 * time.Second
+
 type serverTransport struct {
-	opts *ServerTransportOptions
+	opts      *ServerTransportOptions
+	httpConns *connListener // connections recognized as http by sniffing, nil unless they are served
 }
 
-var serverTransportMap = make(map[string]ServerTransport)
+// ServerTransportFactory builds a server transport whose options are fixed once built
+type ServerTransportFactory func(opts ...ServerTransportOption) ServerTransport
+
+var (
+	serverTransportMap = make(map[string]ServerTransportFactory)
+	serverTransportMu  sync.RWMutex
+)
 
 func init() {
-	serverTransportMap["default"] = DefaultServerTransport
+	RegisterServerTransport("default", NewServerTransport)
 }
 
-var DefaultServerTransport = NewServerTransport()
-
-var NewServerTransport = func() ServerTransport {
-	return &serverTransport{
+var NewServerTransport = func(opts ...ServerTransportOption) ServerTransport {
+	s := &serverTransport{
 		opts: &ServerTransportOptions{},
 	}
+	for _, o := range opts {
+		o(s.opts)
+	}
+	return s
 }
 
-func RegisterServerTransport(name string, serverTransport ServerTransport) {
-	if serverTransportMap == nil {
-		serverTransportMap = make(map[string]ServerTransport)
-	}
-	serverTransportMap[name] = serverTransport
+// RegisterServerTransport registers the factory of the server transports of a protocol
+func RegisterServerTransport(name string, factory ServerTransportFactory) {
+	serverTransportMu.Lock()
+	defer serverTransportMu.Unlock()
+	serverTransportMap[name] = factory
 }
 
-func GetServerTransport(transport string) ServerTransport {
-	if v, ok := serverTransportMap[transport]; ok {
-		return v
+// GetServerTransport builds a server transport with the factory registered under name,
+// or with the default one if there is none
+func GetServerTransport(name string, opts ...ServerTransportOption) ServerTransport {
+	serverTransportMu.RLock()
+	factory, ok := serverTransportMap[name]
+	serverTransportMu.RUnlock()
+	if !ok {
+		factory = NewServerTransport
 	}
-	return DefaultServerTransport
+	return factory(opts...)
 }
 
+// ListenAndServe starts serving in the background until ctx is done,
+// opts apply to this listener only and leave the transport untouched
 func (s *serverTransport) ListenAndServe(ctx context.Context, opts ...ServerTransportOption) error {
+	serveOpts := *s.opts
 	for _, o := range opts {
-		o(s.opts)
+		o(&serveOpts)
 	}
-	if strings.Index(s.opts.Network, "tcp") != -1 {
-		return s.ListenAndServeTcp(ctx, opts...)
+	st := &serverTransport{opts: &serveOpts}
+
+	switch {
+	case strings.Index(st.opts.Network, "tcp") != -1:
+		return st.ListenAndServeTcp(ctx)
+	case st.opts.Network == "unix":
+		return st.ListenAndServeUnix(ctx)
+	case strings.Index(st.opts.Network, "udp") != -1:
+		return st.ListenAndServeUdp(ctx)
 	}
 	return errors.New("network protocol not supported")
 }
@@ -64,24 +95,77 @@ func (s *serverTransport) ListenAndServeTcp(ctx context.Context, opts ...ServerT
 		return err
 	}
 
+	s.start(ctx, lis)
+	return nil
+}
+
+// ListenAndServeUnix listens on the socket file at the server address. A stale socket file
+// left behind by a previous process is removed first, the socket file is removed once the
+// listener is closed.
+func (s *serverTransport) ListenAndServeUnix(ctx context.Context, opts ...ServerTransportOption) error {
+
+	if err := removeStaleSocket(s.opts.Address); err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("unix", s.opts.Address)
+	if err != nil {
+		return err
+	}
+
+	if s.opts.SocketMode != 0 {
+		if err := os.Chmod(s.opts.Address, s.opts.SocketMode); err != nil {
+			lis.Close()
+			return err
+		}
+	}
+
+	s.start(ctx, lis)
+	return nil
+}
+
+// removeStaleSocket removes the socket file at path unless a server still accepts connections on it
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s already exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s already in use", path)
+	}
+	return os.Remove(path)
+}
+
+// start serves lis in the background until ctx is done
+func (s *serverTransport) start(ctx context.Context, lis net.Listener) {
+	if s.opts.Sniffing && s.opts.HTTPHandler != nil {
+		s.serveHTTP(ctx, lis.Addr())
+	}
+
+	// stop accepting once the server is done
+	go func() {
+		<-ctx.Done()
+		lis.Close()
+	}()
+
 	go func() {
-		if err = s.serve(ctx, lis); err != nil {
+		if err := s.serve(ctx, lis); err != nil && ctx.Err() == nil {
 			log.Errorf("transport serve error, %v", err)
 		}
 	}()
-
-	return nil
 }
 
 func (s *serverTransport) serve(ctx context.Context, lis net.Listener) error {
 
 	var tempDelay time.Duration
 
-	tl, ok := lis.(*net.TCPListener)
-	if !ok {
-		return errors.New("network not supported")
-	}
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -89,7 +173,7 @@ func (s *serverTransport) serve(ctx context.Context, lis net.Listener) error {
 		default:
 		}
 
-		conn, err := tl.AcceptTCP()
+		conn, err := lis.Accept()
 		if err != nil {
 			if ne, ok := err.(net.Error); ok && ne.Temporary() {
 				if tempDelay == 0 {
@@ -105,30 +189,78 @@ func (s *serverTransport) serve(ctx context.Context, lis net.Listener) error {
 			}
 			return err
 		}
+		tempDelay = 0
 
-		if err = conn.SetKeepAlive(true); err != nil {
-			return err
+		// keepalives only make sense over tcp
+		if tc, ok := conn.(*net.TCPConn); ok {
+			if err = tc.SetKeepAlive(true); err != nil {
+				return err
+			}
+
+			if s.opts.KeepAlivePeriod != 0 {
+				_ = tc.SetKeepAlivePeriod(s.opts.KeepAlivePeriod)
+			}
 		}
 
-		if s.opts.KeepAlivePeriod != 0 {
-			_ = conn.SetKeepAlivePeriod(s.opts.KeepAlivePeriod)
+		if s.opts.TLSConfig != nil {
+			conn = tls.Server(conn, s.opts.TLSConfig)
 		}
 
 		go func() {
-			if err := s.handleConn(ctx, wrapConn(conn)); err != nil {
-				log.Errorf("gorpc handle tcp conn error, %v", err)
+			if err := s.handleConn(ctx, conn); err != nil {
+				log.Errorf("gorpc handle %s conn error, %v", s.opts.Network, err)
 			}
 		}()
 
 	}
 }
 
-func (s *serverTransport) handleConn(ctx context.Context, conn *connWrapper) error {
+func (s *serverTransport) handleConn(ctx context.Context, conn net.Conn) error {
+
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := handshake(tc); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	ctx = peer.NewContext(ctx, peer.New(conn))
+
+	protocol := s.opts.Protocol
+	if s.opts.Sniffing {
+		// the frames are served with the codec of the server, with the default one on json-rpc servers
+		frames := s.opts.Protocol
+		if frames == "" || frames == codec.JSONRPC {
+			frames = codec.Proto
+		}
+		sc, sniffed, err := sniff(conn, frames)
+		if err != nil {
+			conn.Close()
+			return err
+		}
+		conn, protocol = sc, sniffed
+	}
+
+	// the http server closes the http connections once done with them
+	if protocol == protocolHTTP {
+		if s.httpConns == nil {
+			conn.Close()
+			return errors.New("http is not served")
+		}
+		return s.httpConns.push(ctx, conn)
+	}
 
 	// close the connection before return
 	// the connection closes only if a network read or write fails
 	defer conn.Close()
 
+	if protocol == codec.JSONRPC {
+		return s.serveJSONRPC(ctx, conn)
+	}
+	return s.serveFrames(ctx, wrapConn(conn), protocol)
+}
+
+// serveFrames serves the zRPC frames of a connection until it is closed, they are encoded with the codec of protocol
+func (s *serverTransport) serveFrames(ctx context.Context, conn *connWrapper, protocol string) error {
 	for {
 		// check upstream ctx is done
 		select {
@@ -147,7 +279,7 @@ func (s *serverTransport) handleConn(ctx context.Context, conn *connWrapper) err
 			return err
 		}
 
-		rsp, err := s.handle(ctx, frame)
+		rsp, err := s.handle(ctx, frame, protocol)
 		if err != nil {
 			log.Errorf("s.handle err is not nil, %v", err)
 		}
@@ -159,6 +291,17 @@ func (s *serverTransport) handleConn(ctx context.Context, conn *connWrapper) err
 
 }
 
+// handshake completes the tls handshake of a connection before its peer is known
+func handshake(conn *tls.Conn) error {
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return err
+	}
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	return conn.SetDeadline(time.Time{})
+}
+
 func (s *serverTransport) read(ctx context.Context, conn *connWrapper) ([]byte, error) {
 	frame, err := conn.framer.ReadFrame(conn)
 	if err != nil {
@@ -167,8 +310,8 @@ func (s *serverTransport) read(ctx context.Context, conn *connWrapper) ([]byte,
 	return frame, nil
 }
 
-func (s *serverTransport) handle(ctx context.Context, frame []byte) ([]byte, error) {
-	cdc := codec.GetCodec(s.opts.Protocol)
+func (s *serverTransport) handle(ctx context.Context, frame []byte, protocol string) ([]byte, error) {
+	cdc := codec.GetCodec(protocol)
 	reqb, err := cdc.Decode(frame)
 	if err != nil {
 		log.Errorf("decode error: %v", err)
@@ -0,0 +1,157 @@
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/codec"
+	"github.com/WeilunZ/zRPC/components/log"
+	"github.com/WeilunZ/zRPC/components/peer"
+)
+
+// protocolHTTP is the protocol of the connections recognized as http by sniffing
+const protocolHTTP = "http"
+
+// sniffTimeout bounds the wait for the first bytes of a connection
+const sniffTimeout = 10 * time.Second
+
+var errListenerClosed = errors.New("listener closed")
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("HEAD "), []byte("DELETE "),
+	[]byte("PATCH "), []byte("OPTIONS "), []byte("CONNECT "), []byte("TRACE "),
+}
+
+// sniffedConn is a connection whose first bytes were read to recognize its protocol, they are read again
+type sniffedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// sniff recognizes the protocol of a connection from its first bytes, the zRPC magic number of the frames
+// of protocol frames, an http method line or the start of a json-rpc message, whitespace included
+func sniff(conn net.Conn, frames string) (*sniffedConn, string, error) {
+	sc := &sniffedConn{Conn: conn, r: bufio.NewReader(conn)}
+	if err := conn.SetReadDeadline(time.Now().Add(sniffTimeout)); err != nil {
+		return nil, "", err
+	}
+	first, err := sc.r.Peek(1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	protocol := ""
+	switch {
+	case first[0] == codec.MagicNumber:
+		protocol = frames
+	case first[0] >= 'A' && first[0] <= 'Z':
+		// request lines are longer than the longest method
+		line, err := sc.r.Peek(len("OPTIONS "))
+		if err != nil {
+			return nil, "", err
+		}
+		for _, method := range httpMethods {
+			if bytes.HasPrefix(line, method) {
+				protocol = protocolHTTP
+				break
+			}
+		}
+	default:
+		// json-rpc messages may start with whitespace, it is skipped up to the size of the buffer
+		for n := 1; isJSONSpace(first[n-1]); n++ {
+			if first, err = sc.r.Peek(n + 1); err != nil {
+				return nil, "", err
+			}
+		}
+		if c := first[len(first)-1]; c == '{' || c == '[' {
+			protocol = codec.JSONRPC
+		}
+		first = first[len(first)-1:]
+	}
+	if protocol == "" {
+		return nil, "", fmt.Errorf("unknown protocol, first byte 0x%x", first[0])
+	}
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, "", err
+	}
+	return sc, protocol, nil
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// serveHTTP serves the connections recognized as http with the http handler until ctx is done
+func (s *serverTransport) serveHTTP(ctx context.Context, addr net.Addr) {
+	s.httpConns = &connListener{addr: addr, conns: make(chan net.Conn), done: make(chan struct{})}
+	server := &http.Server{
+		Handler:           s.opts.HTTPHandler,
+		ReadHeaderTimeout: sniffTimeout,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			if sc, ok := c.(*sniffedConn); ok {
+				return peer.NewContext(ctx, peer.New(sc.Conn))
+			}
+			return ctx
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.Serve(s.httpConns); err != nil && err != http.ErrServerClosed && ctx.Err() == nil {
+			log.Errorf("http serve error, %v", err)
+		}
+	}()
+}
+
+// connListener hands the connections recognized as http over to an http server
+type connListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.addr
+}
+
+// push hands a connection over to the http server, which closes it once done with it
+func (l *connListener) push(ctx context.Context, conn net.Conn) error {
+	select {
+	case l.conns <- conn:
+		return nil
+	case <-l.done:
+	case <-ctx.Done():
+	}
+	conn.Close()
+	return errListenerClosed
+}
@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/WeilunZ/zRPC/components/codec"
+)
+
+func TestSniff(t *testing.T) {
+	frame, _ := codec.DefaultCodec.Encode([]byte("request"))
+	tests := []struct {
+		first    string
+		frames   string
+		protocol string
+	}{
+		{string(frame), codec.Proto, codec.Proto},
+		{string(frame), "custom", "custom"},
+		{`{"jsonrpc":"2.0"}`, codec.Proto, codec.JSONRPC},
+		{`[]`, codec.Proto, codec.JSONRPC},
+		{" \r\n\t{\"jsonrpc\":\"2.0\"}", codec.Proto, codec.JSONRPC},
+		{"\n\n[]", codec.Proto, codec.JSONRPC},
+		{"  ", codec.Proto, ""},
+		{" GET / HTTP/1.1\r\n", codec.Proto, ""},
+		{"POST /helloworld.Greeter/SayHello HTTP/1.1\r\n", codec.Proto, protocolHTTP},
+		{"GET / HTTP/1.1\r\n", codec.Proto, protocolHTTP},
+		{"HELLO WORLD\r\n", codec.Proto, ""},
+		{"\x16\x03\x01", codec.Proto, ""},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		go func() {
+			client.Write([]byte(tt.first))
+			client.Close()
+		}()
+		conn, protocol, err := sniff(server, tt.frames)
+		if tt.protocol == "" {
+			if err == nil {
+				t.Errorf("sniff(%q) = %s, want an error", tt.first, protocol)
+			}
+			server.Close()
+			continue
+		}
+		if err != nil || protocol != tt.protocol {
+			t.Errorf("sniff(%q) = %s, %v, want %s", tt.first, protocol, err, tt.protocol)
+			server.Close()
+			continue
+		}
+		// the sniffed bytes are read again
+		if data, _ := ioutil.ReadAll(conn); string(data) != tt.first {
+			t.Errorf("sniff(%q) reads %q", tt.first, data)
+		}
+		server.Close()
+	}
+}
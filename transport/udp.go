@@ -0,0 +1,330 @@
+package transport
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/codec"
+	"github.com/WeilunZ/zRPC/components/log"
+	"github.com/WeilunZ/zRPC/components/peer"
+	"github.com/WeilunZ/zRPC/components/selector"
+	"github.com/WeilunZ/zRPC/components/state"
+	"github.com/golang/protobuf/proto"
+)
+
+// Datagram : [请求id 8b][frame]
+const (
+	RequestIDLength = 8
+	// MaxDatagramSize bounds requests and responses sent over udp, well under the 1500 bytes
+	// ethernet MTU once the ip and udp headers are added so that datagrams are never fragmented
+	MaxDatagramSize = 1200
+
+	defaultRetransmitInterval = 200 * time.Millisecond
+	maxRetransmits            = 4
+
+	// responseCacheTTL is how long a response answers the retransmits of its request
+	responseCacheTTL = 10 * time.Second
+	// maxCachedResponses bounds the requests whose response is cached, the oldest are evicted
+	maxCachedResponses = 4096
+)
+
+var ErrDatagramTooLarge = fmt.Errorf("datagram larger than %d bytes", MaxDatagramSize)
+
+// ErrTLSOverUDP is returned by the servers and the calls over udp set up with a tls config
+var ErrTLSOverUDP = errors.New("tls is not supported over udp")
+
+var requestID = rand.New(rand.NewSource(time.Now().UnixNano())).Uint64()
+
+// ListenAndServeUdp serves one request per datagram. Clients retransmit a request until they get
+// a response, a retransmit is answered with the response of its request rather than served again
+// as long as the request is among the last maxCachedResponses ones and answered less than
+// responseCacheTTL ago.
+func (s *serverTransport) ListenAndServeUdp(ctx context.Context, opts ...ServerTransportOption) error {
+
+	if s.opts.TLSConfig != nil {
+		return ErrTLSOverUDP
+	}
+	if s.opts.Protocol == codec.JSONRPC {
+		return errors.New("json-rpc is not supported over udp")
+	}
+	if s.opts.Sniffing {
+		return errors.New("protocol sniffing is not supported over udp")
+	}
+
+	conn, err := net.ListenPacket(s.opts.Network, s.opts.Address)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	go func() {
+		if err := s.servePacket(ctx, conn); err != nil && ctx.Err() == nil {
+			log.Errorf("transport serve error, %v", err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *serverTransport) servePacket(ctx context.Context, conn net.PacketConn) error {
+	// one byte more than the limit tells oversized datagrams apart
+	buf := make([]byte, MaxDatagramSize+1)
+	cache := newResponseCache(maxCachedResponses)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+
+		id, frame, err := parseDatagram(buf[:n])
+		if err != nil {
+			log.Errorf("invalid datagram from %s, %v", addr, err)
+			continue
+		}
+		frame = append([]byte(nil), frame...)
+
+		// retransmits of a request still served are answered once it is
+		key := requestKey{addr: addr.String(), id: id}
+		if rsp, ok := cache.start(key); ok {
+			if rsp != nil {
+				if _, err := conn.WriteTo(newDatagram(id, rsp), addr); err != nil {
+					log.Errorf("conn WriteTo err: %v", err)
+				}
+			}
+			continue
+		}
+
+		go func() {
+			rsp, err := s.handle(peer.NewContext(ctx, &peer.Peer{Addr: addr}), frame, s.opts.Protocol)
+			if err != nil {
+				log.Errorf("s.handle err is not nil, %v", err)
+				cache.done(key, nil)
+				return
+			}
+			if RequestIDLength+len(rsp) > MaxDatagramSize {
+				if rsp, err = s.encodeError(state.New(state.InternalError, ErrDatagramTooLarge.Error())); err != nil {
+					cache.done(key, nil)
+					return
+				}
+			}
+			cache.done(key, rsp)
+			if _, err := conn.WriteTo(newDatagram(id, rsp), addr); err != nil {
+				log.Errorf("conn WriteTo err: %v", err)
+			}
+		}()
+	}
+}
+
+// requestKey identifies a request by its client address and its id
+type requestKey struct {
+	addr string
+	id   uint64
+}
+
+type cachedResponse struct {
+	key     requestKey
+	frame   []byte    // nil while the request is served
+	expires time.Time // zero while the request is served
+}
+
+// responseCache keeps the responses of the last requests served over udp to answer their retransmits
+type responseCache struct {
+	size int
+
+	mu        sync.Mutex
+	responses map[requestKey]*list.Element // request -> element of order holding its *cachedResponse
+	order     *list.List                   // requests from the oldest to the newest
+}
+
+func newResponseCache(size int) *responseCache {
+	return &responseCache{
+		size:      size,
+		responses: make(map[requestKey]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// start returns the response of a request and true if the request was already received,
+// the response is nil while it is served. Otherwise the request is recorded as served.
+func (c *responseCache) start(key requestKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for e := c.order.Front(); e != nil && expired(e.Value.(*cachedResponse), now); e = c.order.Front() {
+		c.remove(e)
+	}
+	if e, ok := c.responses[key]; ok {
+		if r := e.Value.(*cachedResponse); !expired(r, now) {
+			return r.frame, true
+		}
+		c.remove(e)
+	}
+	if c.order.Len() >= c.size {
+		c.remove(c.order.Front())
+	}
+	c.responses[key] = c.order.PushBack(&cachedResponse{key: key})
+	return nil, false
+}
+
+// done records the response of a request, a nil response serves its retransmits again
+func (c *responseCache) done(key requestKey, frame []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.responses[key]
+	if !ok {
+		// evicted while served
+		return
+	}
+	if frame == nil {
+		c.remove(e)
+		return
+	}
+	r := e.Value.(*cachedResponse)
+	r.frame, r.expires = frame, time.Now().Add(responseCacheTTL)
+}
+
+func (c *responseCache) remove(e *list.Element) {
+	delete(c.responses, e.Value.(*cachedResponse).key)
+	c.order.Remove(e)
+}
+
+func expired(r *cachedResponse, now time.Time) bool {
+	return !r.expires.IsZero() && r.expires.Before(now)
+}
+
+// encodeError encodes the response frame of a failed request
+func (s *serverTransport) encodeError(e error) ([]byte, error) {
+	rspPb, err := proto.Marshal(wrapResponse(nil, e))
+	if err != nil {
+		return nil, err
+	}
+	return codec.GetCodec(s.opts.Protocol).Encode(rspPb)
+}
+
+// SendUdpReq sends a request in a single datagram, retransmitted until a response arrives
+func (c *clientTransport) SendUdpReq(ctx context.Context, req []byte) ([]byte, error) {
+
+	if RequestIDLength+len(req) > MaxDatagramSize {
+		return nil, ErrDatagramTooLarge
+	}
+
+	// calls pinned to a node skip the service discovery
+	if node, ok := selector.NodeFromContext(ctx); ok {
+		return c.roundTripPacket(ctx, node.Address, req)
+	}
+
+	// service discovery
+	node, done, err := c.opts.Selector.Select(ctx, c.opts.ServiceName, c.opts.SelectOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	frame, err := c.roundTripPacket(ctx, node.Address, req)
+	done(selector.DoneInfo{Err: err, Latency: time.Since(start)})
+
+	return frame, err
+}
+
+func (c *clientTransport) roundTripPacket(ctx context.Context, addr string, req []byte) ([]byte, error) {
+
+	conn, err := net.Dial(c.opts.Network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+
+	id := atomic.AddUint64(&requestID, 1)
+	datagram := newDatagram(id, req)
+	interval := c.opts.RetransmitInterval
+	if interval <= 0 {
+		interval = defaultRetransmitInterval
+	}
+
+	buf := make([]byte, MaxDatagramSize+1)
+	for attempt := 0; attempt <= maxRetransmits; attempt++ {
+		if _, err := conn.Write(datagram); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(interval)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+
+		for {
+			n, err := conn.Read(buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			// responses to earlier attempts of other requests are dropped
+			rspID, frame, err := parseDatagram(buf[:n])
+			if err != nil || rspID != id {
+				continue
+			}
+			return append([]byte(nil), frame...), nil
+		}
+
+		if err := isDone(ctx); err != nil {
+			return nil, err
+		}
+		interval *= 2
+	}
+
+	return nil, fmt.Errorf("no response from %s after %d retransmissions", addr, maxRetransmits)
+}
+
+func newDatagram(id uint64, frame []byte) []byte {
+	datagram := make([]byte, RequestIDLength+len(frame))
+	binary.BigEndian.PutUint64(datagram, id)
+	copy(datagram[RequestIDLength:], frame)
+	return datagram
+}
+
+// parseDatagram returns the request id and the frame of a datagram, checking the frame is whole
+func parseDatagram(datagram []byte) (uint64, []byte, error) {
+	if len(datagram) > MaxDatagramSize {
+		return 0, nil, ErrDatagramTooLarge
+	}
+	if len(datagram) < RequestIDLength+codec.FrameHeaderLength {
+		return 0, nil, errors.New("datagram too short")
+	}
+	id := binary.BigEndian.Uint64(datagram)
+	frame := datagram[RequestIDLength:]
+	if frame[0] != codec.MagicNumber {
+		return 0, nil, errors.New("invalid magic")
+	}
+	if length := binary.BigEndian.Uint32(frame[7:11]); int(length) != len(frame)-codec.FrameHeaderLength {
+		return 0, nil, errors.New("truncated frame")
+	}
+	return id, frame, nil
+}
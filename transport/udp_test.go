@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/WeilunZ/zRPC/components/codec"
+	"github.com/WeilunZ/zRPC/components/selector"
+)
+
+func TestUdpRetransmission(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	rspFrame, _ := codec.DefaultCodec.Encode([]byte("response"))
+	received := make(chan int, 1)
+	go func() {
+		buf := make([]byte, MaxDatagramSize)
+		for attempt := 1; ; attempt++ {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// the first datagram is lost
+			if attempt == 1 {
+				continue
+			}
+			id, _, err := parseDatagram(buf[:n])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.WriteTo(newDatagram(id+1, rspFrame), addr) // stale response of another request
+			conn.WriteTo(newDatagram(id, rspFrame), addr)
+			received <- attempt
+			return
+		}
+	}()
+
+	c := New(WithClientNetwork("udp"), WithRetransmitInterval(20*time.Millisecond))
+	reqFrame, _ := codec.DefaultCodec.Encode([]byte("request"))
+	ctx := selector.WithNode(context.Background(), &selector.Node{Address: conn.LocalAddr().String()})
+	frame, err := c.Send(ctx, reqFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame, rspFrame) {
+		t.Fatalf("Send() = %q", frame)
+	}
+	if attempt := <-received; attempt != 2 {
+		t.Fatalf("answered attempt %d", attempt)
+	}
+
+	if _, err := c.Send(ctx, make([]byte, MaxDatagramSize)); err != ErrDatagramTooLarge {
+		t.Fatalf("oversized request error = %v", err)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	c := newResponseCache(2)
+	first, second, third := requestKey{addr: "a", id: 1}, requestKey{addr: "a", id: 2}, requestKey{addr: "b", id: 1}
+
+	if _, ok := c.start(first); ok {
+		t.Fatal("first request already received")
+	}
+	if rsp, ok := c.start(first); !ok || rsp != nil {
+		t.Fatalf("retransmit of a request served = %v, %v", rsp, ok)
+	}
+	c.done(first, []byte("first"))
+	if rsp, ok := c.start(first); !ok || string(rsp) != "first" {
+		t.Fatalf("retransmit of a request answered = %s, %v", rsp, ok)
+	}
+
+	// the oldest requests are evicted past the size of the cache
+	c.start(second)
+	c.start(third)
+	if len(c.responses) != 2 || c.order.Len() != 2 {
+		t.Fatalf("%d requests cached, want 2", len(c.responses))
+	}
+	if _, ok := c.start(first); ok {
+		t.Fatal("evicted request still cached")
+	}
+
+	// a request failing to be served is served again
+	c.done(third, nil)
+	if _, ok := c.start(third); ok {
+		t.Fatal("failed request still cached")
+	}
+}